@@ -1,15 +1,25 @@
 package main
 
 import (
+	"context"
 	"distributed-task-scheduler/internal/cluster"
 	"distributed-task-scheduler/internal/metrics"
 	"distributed-task-scheduler/internal/routes"
 	"distributed-task-scheduler/internal/scheduler"
 	"distributed-task-scheduler/pkg/database"
 	"distributed-task-scheduler/pkg/repositories"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
+	_ "time/tzdata" // schedules may name any IANA timezone
 )
 
 // @title Distributed Task Scheduler API
@@ -20,6 +30,7 @@ import (
 // @schemes http
 func main() {
 	metrics.Init()
+	metrics.EnableTaskLabels(envList("METRIC_TASK_LABELS"), envInt("METRIC_TASK_LABEL_VALUES", 50))
 
 	// Init PostgreSQL with GORM
 	database.InitGorm()
@@ -28,33 +39,212 @@ func main() {
 	// Init repository
 	taskRepo := repositories.NewTaskRepository(db)
 
-	// Init scheduler
-	queue := scheduler.NewPriorityQueue()
+	// Identity of this node in the cluster
+	nodeID := cluster.NodeIDFromEnv()
+
+	// Per-priority limits on how long one attempt of a task may run
+	scheduler.SetDefaultTimeout(scheduler.High, envDuration("TASK_TIMEOUT_HIGH", scheduler.DefaultTimeout(scheduler.High)))
+	scheduler.SetDefaultTimeout(scheduler.Medium, envDuration("TASK_TIMEOUT_MEDIUM", scheduler.DefaultTimeout(scheduler.Medium)))
+	scheduler.SetDefaultTimeout(scheduler.Low, envDuration("TASK_TIMEOUT_LOW", scheduler.DefaultTimeout(scheduler.Low)))
+
+	// Init scheduler. Every replica must use the postgres queue when more
+	// than one node runs against the same database.
+	// With QUEUE_AGING_STEP set, waiting tasks gain a priority level per step
+	agingStep := envDuration("QUEUE_AGING_STEP", 0)
+	var queue scheduler.Queue
+	switch os.Getenv("QUEUE_BACKEND") {
+	case "postgres":
+		log.Println("[Scheduler] Using the shared Postgres queue")
+		dbQueue := scheduler.NewDBQueue(taskRepo, nodeID, envDuration("QUEUE_POLL_INTERVAL", time.Second))
+		dbQueue.SetAging(agingStep)
+		queue = dbQueue
+	case "fair":
+		// Shares already keep every priority moving, and a level's tasks run in push order
+		if agingStep > 0 {
+			log.Fatal("QUEUE_AGING_STEP doesn't apply to QUEUE_BACKEND=fair; use QUEUE_FAIR_WEIGHTS to give low priorities a share")
+		}
+		log.Println("[Scheduler] Using the weighted fair queue")
+		queue = newFairQueue()
+	default:
+		heapQueue := scheduler.NewPriorityQueue()
+		heapQueue.SetAging(agingStep)
+		queue = heapQueue
+	}
 	taskScheduler := scheduler.NewTaskScheduler(queue, taskRepo)
+	taskScheduler.SetNodeID(nodeID)
+	taskScheduler.SetIdempotencyWindow(envDuration("IDEMPOTENCY_WINDOW", 24*time.Hour))
+	taskScheduler.SetMaxBatchSize(envInt("TASK_BATCH_MAX", taskScheduler.MaxBatchSize()))
+	// Bound the in-memory queues; submissions past a limit get a 429
+	taskScheduler.SetQueueLimits(scheduler.QueueLimits{
+		Max: envInt("QUEUE_MAX_DEPTH", 0),
+		PerLevel: map[scheduler.TaskPriority]int{
+			scheduler.High:   envInt("QUEUE_MAX_DEPTH_HIGH", 0),
+			scheduler.Medium: envInt("QUEUE_MAX_DEPTH_MEDIUM", 0),
+			scheduler.Low:    envInt("QUEUE_MAX_DEPTH_LOW", 0),
+		},
+		RetryAfter: envDuration("QUEUE_RETRY_AFTER", 5*time.Second),
+	})
+
+	// Register task handlers
+	registry := scheduler.NewHandlerRegistry()
+	registerHandlers(registry)
 
 	// Init worker pool with repo too
-	workerPool := scheduler.NewWorkerPool(queue, taskRepo, 4)
+	workerPool := scheduler.NewWorkerPool(queue, taskRepo, registry, nodeID, 4)
+	// On shutdown, running tasks get this long to finish before they are interrupted
+	workerPool.SetDrainTimeout(envDuration("WORKER_DRAIN_TIMEOUT", 10*time.Second))
+	taskScheduler.OnCancel(workerPool.CancelRunning)
+	workerPool.OnFinish(taskScheduler.TaskFinished)
+	workerPool.SetTaskLock(taskScheduler.TaskLock())
 
 	// Recover tasks from DB
-	taskScheduler.RecoverUnfinishedTasks()
+	taskScheduler.RecoverUnfinishedTasks(nodeID)
 
 	// Start workers
 	workerPool.Start()
-	defer workerPool.Stop()
 
 	// Cluster logic
-	leader := cluster.NewLeaderElector(func() {
-		log.Println("[Cluster] I am the leader. I can assign tasks.")
+	var leader cluster.Elector = cluster.NewLeaderElector(nodeID, cluster.NewPostgresBackend(db), envDuration("LEADER_LEASE_TTL", 10*time.Second))
+	leader.OnLeadershipChange(func(isLeader bool) {
+		if isLeader {
+			log.Println("[Cluster] I am the leader. I can assign tasks.")
+		} else {
+			log.Println("[Cluster] Lost leadership.")
+		}
 	})
 	leader.Start()
-	defer leader.Stop()
 
-	heartBeater := cluster.NewHeartbeater(leader.NodeID, 5*time.Second)
+	// Recurring schedules are only evaluated on the leader
+	scheduleRunner := scheduler.NewScheduleRunner(taskScheduler, leader.IsCurrentLeader,
+		envDuration("SCHEDULE_INTERVAL", 10*time.Second), os.Getenv("SCHEDULE_CATCH_UP"))
+	scheduleRunner.Start()
+
+	// The leader requeues tasks left running by dead nodes
+	reclaimer := scheduler.NewReclaimer(taskScheduler, leader.IsCurrentLeader, 5*time.Second)
+	reclaimer.Start()
+
+	address := os.Getenv("NODE_ADDRESS")
+	if address == "" {
+		hostname, _ := os.Hostname()
+		address = hostname + ":8080"
+	}
+	nodeRepo := repositories.NewNodeRepository(db)
+	heartBeater := cluster.NewHeartbeater(nodeID, cluster.HeartbeatConfig{
+		Address:     address,
+		Interval:    5 * time.Second,
+		MissedBeats: envInt("NODE_MISSED_HEARTBEATS", 3),
+	}, nodeRepo, leader, workerPool.Stats)
 	heartBeater.Start()
-	defer heartBeater.Stop()
 	router := gin.Default()
-	routes.RegisterRoutes(router, taskScheduler)
+	routes.RegisterRoutes(router, taskScheduler, nodeRepo)
+
+	server := &http.Server{Addr: ":8080", Handler: router}
+	go func() {
+		log.Println("🚀 Server running at http://localhost:8080")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	// Shut down in order: the node keeps heartbeating until its workers are
+	// done, so the leader doesn't reclaim tasks that are still running here
+	log.Println("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server shutdown: %v", err)
+	}
+	workerPool.Stop()
+	reclaimer.Stop()
+	scheduleRunner.Stop()
+	leader.Stop()
+	heartBeater.Stop()
+}
+
+// registerHandlers binds the built-in task types
+func registerHandlers(registry *scheduler.HandlerRegistry) {
+	// echo returns its payload unchanged
+	registry.Register("echo", func(ctx context.Context, payload interface{}) (interface{}, error) {
+		return payload, nil
+	})
+
+	// sleep waits for {"seconds": n} or until the task is cancelled
+	registry.Register("sleep", func(ctx context.Context, payload interface{}) (interface{}, error) {
+		params, _ := payload.(map[string]interface{})
+		seconds, ok := params["seconds"].(float64)
+		if !ok {
+			return nil, fmt.Errorf("sleep payload needs a numeric \"seconds\" field")
+		}
+		select {
+		case <-time.After(time.Duration(seconds * float64(time.Second))):
+			return map[string]interface{}{"slept": seconds}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+}
+
+// newFairQueue configures a FairQueue from QUEUE_FAIR_WEIGHTS ("70,20,10"),
+// QUEUE_FAIR_TENANT_LABEL and QUEUE_FAIR_TENANT_WEIGHTS ("acme=3,globex=1")
+func newFairQueue() *scheduler.FairQueue {
+	weights := scheduler.DefaultFairWeights
+	if v := os.Getenv("QUEUE_FAIR_WEIGHTS"); v != "" {
+		parsed, err := scheduler.ParseWeights(v)
+		if err != nil {
+			log.Fatalf("Invalid QUEUE_FAIR_WEIGHTS=%q: %v", v, err)
+		}
+		weights = parsed
+	}
+	tenantWeights, err := scheduler.ParseNamedWeights(os.Getenv("QUEUE_FAIR_TENANT_WEIGHTS"))
+	if err != nil {
+		log.Fatalf("Invalid QUEUE_FAIR_TENANT_WEIGHTS: %v", err)
+	}
+	queue, err := scheduler.NewFairQueue(weights, os.Getenv("QUEUE_FAIR_TENANT_LABEL"), tenantWeights)
+	if err != nil {
+		log.Fatalf("Invalid fair queue configuration: %v", err)
+	}
+	return queue
+}
+
+// envDuration reads a duration such as "10s" from the environment
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("Ignoring invalid %s=%q, using %s", key, v, def)
+		return def
+	}
+	return d
+}
+
+// envInt reads a positive integer from the environment
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Printf("Ignoring invalid %s=%q, using %d", key, v, def)
+		return def
+	}
+	return n
+}
 
-	log.Println("🚀 Server running at http://localhost:8080")
-	router.Run(":8080")
+// envList reads a comma-separated list from the environment
+func envList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
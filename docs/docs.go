@@ -15,50 +15,186 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/api/v1/tasks": {
+        "/api/v1/cluster/nodes": {
             "get": {
-                "description": "Returns a list of all tasks",
+                "description": "Returns every node that has sent a heartbeat, with its status, last heartbeat and load",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Tasks"
+                    "Cluster"
+                ],
+                "summary": "List cluster members",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Node"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/dead-letters": {
+            "get": {
+                "description": "Returns tasks that exhausted their retries, newest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "DeadLetters"
                 ],
-                "summary": "Get all tasks",
+                "summary": "List dead-lettered tasks",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/scheduler.Task"
+                                "$ref": "#/definitions/models.DeadLetter"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
                             }
                         }
                     }
                 }
             },
-            "post": {
-                "description": "Submit a task with priority and JSON payload",
-                "consumes": [
+            "delete": {
+                "description": "Removes every entry from the dead-letter queue",
+                "produces": [
                     "application/json"
                 ],
+                "tags": [
+                    "DeadLetters"
+                ],
+                "summary": "Purge all dead-lettered tasks",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "integer"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/dead-letters/{id}": {
+            "get": {
+                "description": "Returns the final error and attempt history of a dead-letter entry",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Tasks"
+                    "DeadLetters"
                 ],
-                "summary": "Submit a new task",
+                "summary": "Inspect a dead-lettered task",
                 "parameters": [
                     {
-                        "description": "Task to submit",
-                        "name": "task",
-                        "in": "body",
-                        "required": true,
+                        "type": "string",
+                        "description": "Dead-letter ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/api.TaskRequest"
+                            "$ref": "#/definitions/models.DeadLetter"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Removes a single entry without requeueing its task",
+                "tags": [
+                    "DeadLetters"
+                ],
+                "summary": "Purge a dead-lettered task",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Dead-letter ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
                         }
                     }
+                }
+            }
+        },
+        "/api/v1/dead-letters/{id}/requeue": {
+            "post": {
+                "description": "Resets the task's attempts, puts it back on the queue and removes the entry",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "DeadLetters"
+                ],
+                "summary": "Requeue a dead-lettered task",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Dead-letter ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
                 "responses": {
                     "202": {
@@ -67,8 +203,8 @@ const docTemplate = `{
                             "$ref": "#/definitions/scheduler.Task"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -79,20 +215,20 @@ const docTemplate = `{
                 }
             }
         },
-        "/tasks/{id}": {
+        "/api/v1/operations/{id}": {
             "get": {
-                "description": "Returns task status",
+                "description": "Returns the status and progress of a bulk operation. matched is the number of tasks the filter selected when it started; processed counts those looked at so far and affected those the action applied to.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Tasks"
+                    "Operations"
                 ],
-                "summary": "Get task by ID",
+                "summary": "Get a bulk operation",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Task ID",
+                        "description": "Operation ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -102,7 +238,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/scheduler.Task"
+                            "$ref": "#/definitions/models.Operation"
                         }
                     },
                     "404": {
@@ -113,56 +249,1563 @@ const docTemplate = `{
                                 "type": "string"
                             }
                         }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "api.TaskRequest": {
-            "type": "object",
-            "required": [
-                "payload",
-                "priority"
-            ],
-            "properties": {
-                "payload": {},
-                "priority": {
-                    "type": "string",
-                    "example": "high"
-                }
-            }
         },
-        "scheduler.Task": {
-            "type": "object",
-            "properties": {
-                "created_at": {
-                    "type": "string"
-                },
-                "id": {
-                    "type": "string"
-                },
-                "payload": {},
-                "priority": {
-                    "$ref": "#/definitions/scheduler.TaskPriority"
-                },
-                "status": {
-                    "type": "string"
+        "/api/v1/schedules": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Schedules"
+                ],
+                "summary": "List recurring tasks",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Schedule"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Stores a cron schedule; the leader submits a task for every firing. String values in the payload may use {{.ScheduleID}}, {{.ScheduleName}} and {{.FireTime}}.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Schedules"
+                ],
+                "summary": "Create a recurring task",
+                "parameters": [
+                    {
+                        "description": "Schedule to create",
+                        "name": "schedule",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.ScheduleRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.Schedule"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
                 }
             }
         },
-        "scheduler.TaskPriority": {
-            "type": "integer",
-            "enum": [
-                0,
-                1,
-                2
-            ],
-            "x-enum-varnames": [
-                "High",
-                "Medium",
-                "Low"
-            ]
+        "/api/v1/schedules/{id}": {
+            "get": {
+                "description": "Returns the schedule including the time it last fired",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Schedules"
+                ],
+                "summary": "Get a recurring task",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Schedule ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Schedule"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Stops future firings; tasks already submitted are kept",
+                "tags": [
+                    "Schedules"
+                ],
+                "summary": "Delete a recurring task",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Schedule ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/tasks": {
+            "get": {
+                "description": "Returns a page of tasks. Filters combine with AND; list filters take comma-separated values. Pass next_cursor from the response as cursor to get the next page.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tasks"
+                ],
+                "summary": "List tasks",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Statuses, e.g. pending,running",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Priorities, e.g. high,250",
+                        "name": "priority",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task types",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time, inclusive",
+                        "name": "created_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time, exclusive",
+                        "name": "created_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Label selector, e.g. env=prod,team in (a,b),!legacy",
+                        "name": "selector",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "created_at",
+                        "description": "created_at or priority; prefix with - for descending",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Page size, at most 1000",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Also count all matching tasks",
+                        "name": "include_total",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/scheduler.TaskList"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Submit a task with a type, priority and JSON payload. Retry settings not given fall back to the defaults for the priority. Set run_at or delay to hold the task until then. Attempts running longer than timeout end as timed_out and are retried like failures. Repeating a submission with the same idempotency key returns the original task with 200; reusing the key for a different request is a 409. A full queue answers 429 with Retry-After.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tasks"
+                ],
+                "summary": "Submit a new task",
+                "parameters": [
+                    {
+                        "description": "Task to submit",
+                        "name": "task",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.TaskRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Idempotency key",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/scheduler.Task"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/scheduler.Task"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes the finished tasks matching the filter; unfinished ones are left alone. At least one filter is required.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tasks"
+                ],
+                "summary": "Delete matching tasks",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Statuses, e.g. completed,failed",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Priorities, e.g. high,250",
+                        "name": "priority",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task types",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time, inclusive",
+                        "name": "created_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time, exclusive",
+                        "name": "created_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Label selector, e.g. env=prod,team in (a,b),!legacy",
+                        "name": "selector",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "integer"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/tasks/batch": {
+            "post": {
+                "description": "Validates each task on its own and stores all valid ones in a single transaction. Results list the created ID or the validation error of every task in input order. Idempotency keys aren't supported in batches. If the valid tasks don't all fit in the queue, none are stored and the answer is 429 with Retry-After.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tasks"
+                ],
+                "summary": "Submit many tasks at once",
+                "parameters": [
+                    {
+                        "description": "Tasks to submit",
+                        "name": "tasks",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/api.TaskRequest"
+                            }
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/api.BatchResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/api.BatchResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/tasks/bulk": {
+            "post": {
+                "description": "Applies one action to every task matching the filter, in the background: cancel unfinished tasks, requeue failed and timed-out ones, set_priority of pending and blocked ones, or delete finished ones. At least one filter is required. Poll the returned operation for progress.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Operations"
+                ],
+                "summary": "Start a bulk operation",
+                "parameters": [
+                    {
+                        "description": "Action to apply",
+                        "name": "operation",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.OperationRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Statuses, e.g. failed,timed_out",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Priorities, e.g. high,250",
+                        "name": "priority",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task types",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time, inclusive",
+                        "name": "created_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time, exclusive",
+                        "name": "created_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Label selector, e.g. env=prod,team in (a,b),!legacy",
+                        "name": "selector",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/models.Operation"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/tasks/cancel": {
+            "post": {
+                "description": "Cancels every unfinished task matching the filter, like POST /tasks/{id}/cancel does for one. At least one filter is required.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tasks"
+                ],
+                "summary": "Cancel matching tasks",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Statuses, e.g. pending,running",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Priorities, e.g. high,250",
+                        "name": "priority",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Task types",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time, inclusive",
+                        "name": "created_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339 time, exclusive",
+                        "name": "created_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Label selector, e.g. env=prod,team in (a,b),!legacy",
+                        "name": "selector",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "integer"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/tasks/{id}": {
+            "get": {
+                "description": "Returns task status",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tasks"
+                ],
+                "summary": "Get task by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Task ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/scheduler.Task"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Changes the priority of a pending or blocked task; a queued task moves to its new place in the queue right away. The change is recorded in the task's history.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tasks"
+                ],
+                "summary": "Change a task's priority",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Task ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New priority",
+                        "name": "task",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.TaskPatchRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/scheduler.Task"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/tasks/{id}/cancel": {
+            "post": {
+                "description": "Cancels a pending task right away (200). A running task is asked to stop (202); it ends up cancelled once the node running it has aborted its handler.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tasks"
+                ],
+                "summary": "Cancel a task",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Task ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/scheduler.Task"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/scheduler.Task"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/tasks/{id}/result": {
+            "get": {
+                "description": "Long-polls until the task has reached a final status or the timeout (default 30s, at most 5m) expires. Returns 200 with the finished task, or 202 with its current state if it is still in progress.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tasks"
+                ],
+                "summary": "Wait for a task's result",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Task ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "How long to wait, e.g. 10s",
+                        "name": "timeout",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/scheduler.Task"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/scheduler.Task"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/workflows": {
+            "post": {
+                "description": "Submits tasks connected by depends_on edges. A task runs once all of its parents have finished; a parent that doesn't complete skips the child, fails it, or lets it run anyway, as set by the edge's on_failure (skip, fail or run; default fail). Cyclic graphs are rejected. If the tasks that can run right away don't fit in the queue, nothing is stored and the answer is 429 with Retry-After.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Workflows"
+                ],
+                "summary": "Submit a workflow",
+                "parameters": [
+                    {
+                        "description": "Workflow to submit",
+                        "name": "workflow",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.WorkflowRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/scheduler.Workflow"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/workflows/{id}": {
+            "get": {
+                "description": "Returns the workflow graph with the status of each task",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Workflows"
+                ],
+                "summary": "Get a workflow",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Workflow ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/scheduler.Workflow"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "api.BatchItemResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "index": {
+                    "type": "integer"
+                }
+            }
+        },
+        "api.BatchResponse": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "type": "integer"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.BatchItemResult"
+                    }
+                }
+            }
+        },
+        "api.OperationRequest": {
+            "type": "object",
+            "required": [
+                "action"
+            ],
+            "properties": {
+                "action": {
+                    "description": "cancel, requeue, set_priority or delete",
+                    "type": "string",
+                    "example": "requeue"
+                },
+                "priority": {
+                    "description": "new priority, for set_priority only",
+                    "type": "string",
+                    "example": "high"
+                }
+            }
+        },
+        "api.RetryRequest": {
+            "type": "object",
+            "properties": {
+                "initial_backoff": {
+                    "type": "string",
+                    "example": "2s"
+                },
+                "jitter": {
+                    "type": "number",
+                    "example": 0.2
+                },
+                "max_attempts": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "max_backoff": {
+                    "type": "string",
+                    "example": "1m"
+                },
+                "multiplier": {
+                    "type": "number",
+                    "example": 2
+                }
+            }
+        },
+        "api.ScheduleRequest": {
+            "type": "object",
+            "required": [
+                "cron",
+                "priority",
+                "type"
+            ],
+            "properties": {
+                "catch_up": {
+                    "description": "none, last or all",
+                    "type": "string",
+                    "example": "last"
+                },
+                "cron": {
+                    "type": "string",
+                    "example": "0 3 * * *"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "nightly-report"
+                },
+                "payload": {},
+                "priority": {
+                    "type": "string",
+                    "example": "low"
+                },
+                "timezone": {
+                    "type": "string",
+                    "example": "Europe/Berlin"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "echo"
+                }
+            }
+        },
+        "api.TaskPatchRequest": {
+            "type": "object",
+            "required": [
+                "priority"
+            ],
+            "properties": {
+                "priority": {
+                    "type": "string",
+                    "example": "high"
+                }
+            }
+        },
+        "api.TaskRequest": {
+            "type": "object",
+            "required": [
+                "payload",
+                "priority",
+                "type"
+            ],
+            "properties": {
+                "delay": {
+                    "description": "or run after this delay",
+                    "type": "string",
+                    "example": "10m"
+                },
+                "idempotency_key": {
+                    "description": "IdempotencyKey makes retried submissions return the original task; the Idempotency-Key header works too",
+                    "type": "string",
+                    "example": "order-1234-invoice"
+                },
+                "labels": {
+                    "description": "e.g. {\"tenant\": \"acme\", \"run\": \"2024-06-01\"}",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "payload": {},
+                "priority": {
+                    "description": "high, medium, low or 0-1000; lower runs first",
+                    "type": "string",
+                    "example": "high"
+                },
+                "retry": {
+                    "$ref": "#/definitions/api.RetryRequest"
+                },
+                "run_at": {
+                    "description": "run at this time (RFC 3339)",
+                    "type": "string",
+                    "example": "2030-01-01T03:00:00Z"
+                },
+                "timeout": {
+                    "description": "limit per attempt; defaults per priority",
+                    "type": "string",
+                    "example": "30s"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "echo"
+                }
+            }
+        },
+        "api.WorkflowRequest": {
+            "type": "object",
+            "required": [
+                "tasks"
+            ],
+            "properties": {
+                "name": {
+                    "type": "string",
+                    "example": "nightly-etl"
+                },
+                "tasks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.WorkflowTaskRequest"
+                    }
+                }
+            }
+        },
+        "api.WorkflowTaskRequest": {
+            "type": "object",
+            "required": [
+                "key",
+                "payload",
+                "priority",
+                "type"
+            ],
+            "properties": {
+                "delay": {
+                    "description": "or run after this delay",
+                    "type": "string",
+                    "example": "10m"
+                },
+                "depends_on": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/scheduler.Dependency"
+                    }
+                },
+                "idempotency_key": {
+                    "description": "IdempotencyKey makes retried submissions return the original task; the Idempotency-Key header works too",
+                    "type": "string",
+                    "example": "order-1234-invoice"
+                },
+                "key": {
+                    "type": "string",
+                    "example": "extract"
+                },
+                "labels": {
+                    "description": "e.g. {\"tenant\": \"acme\", \"run\": \"2024-06-01\"}",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "payload": {},
+                "priority": {
+                    "description": "high, medium, low or 0-1000; lower runs first",
+                    "type": "string",
+                    "example": "high"
+                },
+                "retry": {
+                    "$ref": "#/definitions/api.RetryRequest"
+                },
+                "run_at": {
+                    "description": "run at this time (RFC 3339)",
+                    "type": "string",
+                    "example": "2030-01-01T03:00:00Z"
+                },
+                "timeout": {
+                    "description": "limit per attempt; defaults per priority",
+                    "type": "string",
+                    "example": "30s"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "echo"
+                }
+            }
+        },
+        "models.AttemptRecord": {
+            "type": "object",
+            "properties": {
+                "attempt": {
+                    "type": "integer"
+                },
+                "detail": {
+                    "description": "what the event changed, e.g. \"900 -\u003e 100\"",
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "event": {
+                    "type": "string"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "started_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.DeadLetter": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "description": "when the task was dead-lettered",
+                    "type": "string"
+                },
+                "final_error": {
+                    "type": "string"
+                },
+                "history": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.AttemptRecord"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "payload": {},
+                "priority": {
+                    "type": "integer",
+                    "maximum": 1000,
+                    "minimum": 0
+                },
+                "task_id": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Node": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_seen_at": {
+                    "type": "string"
+                },
+                "load": {
+                    "description": "tasks executing at the last heartbeat",
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "worker_count": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.Operation": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "affected": {
+                    "description": "how many the action applied to",
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "filter": {
+                    "type": "object"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "matched": {
+                    "description": "tasks matching the filter when the operation started",
+                    "type": "integer"
+                },
+                "node_id": {
+                    "type": "string"
+                },
+                "priority": {
+                    "description": "new priority of set_priority",
+                    "type": "integer",
+                    "maximum": 1000,
+                    "minimum": 0
+                },
+                "processed": {
+                    "description": "of those, how many have been looked at",
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Schedule": {
+            "type": "object",
+            "properties": {
+                "catch_up": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "cron": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_fire_at": {
+                    "description": "scheduled time of the most recent firing",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "payload": {
+                    "description": "template rendered on every firing"
+                },
+                "priority": {
+                    "type": "integer",
+                    "maximum": 1000,
+                    "minimum": 0
+                },
+                "timezone": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "scheduler.Dependency": {
+            "type": "object",
+            "properties": {
+                "key": {
+                    "type": "string"
+                },
+                "on_failure": {
+                    "description": "skip, fail or run; defaults to fail",
+                    "type": "string"
+                }
+            }
+        },
+        "scheduler.RetryPolicy": {
+            "type": "object",
+            "properties": {
+                "initial_backoff": {
+                    "type": "string",
+                    "example": "1s"
+                },
+                "jitter": {
+                    "description": "fraction of the backoff to randomise, 0..1",
+                    "type": "number"
+                },
+                "max_attempts": {
+                    "type": "integer"
+                },
+                "max_backoff": {
+                    "type": "string",
+                    "example": "1m0s"
+                },
+                "multiplier": {
+                    "type": "number"
+                }
+            }
+        },
+        "scheduler.Task": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "cancel_requested": {
+                    "description": "CancelRequested is set while a running task is being cancelled",
+                    "type": "boolean"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "history": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.AttemptRecord"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "labels": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "payload": {},
+                "priority": {
+                    "type": "integer",
+                    "maximum": 1000,
+                    "minimum": 0
+                },
+                "result": {},
+                "retry": {
+                    "$ref": "#/definitions/scheduler.RetryPolicy"
+                },
+                "run_at": {
+                    "description": "not runnable before this time",
+                    "type": "string"
+                },
+                "started_at": {
+                    "description": "When the latest attempt started and when the task reached its final status",
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "timeout": {
+                    "description": "limit per attempt",
+                    "type": "string",
+                    "example": "30s"
+                },
+                "type": {
+                    "type": "string"
+                },
+                "workflow_id": {
+                    "description": "Set on tasks submitted as part of a workflow",
+                    "type": "string"
+                },
+                "workflow_key": {
+                    "type": "string"
+                }
+            }
+        },
+        "scheduler.TaskList": {
+            "type": "object",
+            "properties": {
+                "next_cursor": {
+                    "description": "pass as cursor to get the next page",
+                    "type": "string"
+                },
+                "tasks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/scheduler.Task"
+                    }
+                },
+                "total": {
+                    "description": "tasks matching the filter across all pages",
+                    "type": "integer"
+                }
+            }
+        },
+        "scheduler.Workflow": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "tasks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/scheduler.WorkflowNode"
+                    }
+                }
+            }
+        },
+        "scheduler.WorkflowNode": {
+            "type": "object",
+            "properties": {
+                "depends_on": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/scheduler.Dependency"
+                    }
+                },
+                "key": {
+                    "type": "string"
+                },
+                "task": {
+                    "$ref": "#/definitions/scheduler.Task"
+                }
+            }
         }
     }
 }`
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"distributed-task-scheduler/internal/scheduler"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// BatchItemResult reports what became of one task of a batch
+type BatchItemResult struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// BatchResponse lists the outcome of every submitted task in input order
+type BatchResponse struct {
+	Created int               `json:"created"`
+	Failed  int               `json:"failed"`
+	Results []BatchItemResult `json:"results"`
+}
+
+// SubmitTaskBatch godoc
+// @Summary Submit many tasks at once
+// @Description Validates each task on its own and stores all valid ones in a single transaction. Results list the created ID or the validation error of every task in input order. Idempotency keys aren't supported in batches. If the valid tasks don't all fit in the queue, none are stored and the answer is 429 with Retry-After.
+// @Tags Tasks
+// @Accept json
+// @Produce json
+// @Param tasks body []TaskRequest true "Tasks to submit"
+// @Success 202 {object} BatchResponse
+// @Failure 400 {object} BatchResponse
+// @Failure 413 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/tasks/batch [post]
+func (h *APIHandler) SubmitTaskBatch(c *gin.Context) {
+	var reqs []TaskRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&reqs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expected a JSON array of tasks: " + err.Error()})
+		return
+	}
+	if len(reqs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "batch is empty"})
+		return
+	}
+	if max := h.Scheduler.MaxBatchSize(); len(reqs) > max {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("batch of %d tasks exceeds the limit of %d", len(reqs), max)})
+		return
+	}
+
+	resp := BatchResponse{Results: make([]BatchItemResult, len(reqs))}
+	specs := make([]scheduler.TaskSpec, 0, len(reqs))
+	valid := make([]int, 0, len(reqs))
+	for i := range reqs {
+		resp.Results[i].Index = i
+		spec, err := reqs[i].batchSpec()
+		if err != nil {
+			resp.Results[i].Error = err.Error()
+			resp.Failed++
+			continue
+		}
+		specs = append(specs, spec)
+		valid = append(valid, i)
+	}
+	if len(specs) == 0 {
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	tasks, err := h.Scheduler.SubmitTasks(specs)
+	if errors.Is(err, scheduler.ErrQueueFull) {
+		h.queueFull(c, err)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store tasks: " + err.Error()})
+		return
+	}
+	for j, task := range tasks {
+		resp.Results[valid[j]].ID = task.ID
+	}
+	resp.Created = len(tasks)
+	c.JSON(http.StatusAccepted, resp)
+}
+
+// batchSpec validates one task of a batch like a single submission would be
+func (req *TaskRequest) batchSpec() (scheduler.TaskSpec, error) {
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		return scheduler.TaskSpec{}, err
+	}
+	if req.IdempotencyKey != "" {
+		return scheduler.TaskSpec{}, fmt.Errorf("idempotency keys aren't supported in batches")
+	}
+	return req.spec()
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListNodes godoc
+// @Summary List cluster members
+// @Description Returns every node that has sent a heartbeat, with its status, last heartbeat and load
+// @Tags Cluster
+// @Produce json
+// @Success 200 {array} models.Node
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/cluster/nodes [get]
+func (h *APIHandler) ListNodes(c *gin.Context) {
+	nodes, err := h.Nodes.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, nodes)
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"distributed-task-scheduler/internal/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// ListDeadLetters godoc
+// @Summary List dead-lettered tasks
+// @Description Returns tasks that exhausted their retries, newest first
+// @Tags DeadLetters
+// @Produce json
+// @Success 200 {array} models.DeadLetter
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/dead-letters [get]
+func (h *APIHandler) ListDeadLetters(c *gin.Context) {
+	entries, err := h.Scheduler.ListDeadLetters()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// GetDeadLetter godoc
+// @Summary Inspect a dead-lettered task
+// @Description Returns the final error and attempt history of a dead-letter entry
+// @Tags DeadLetters
+// @Produce json
+// @Param id path string true "Dead-letter ID"
+// @Success 200 {object} models.DeadLetter
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/dead-letters/{id} [get]
+func (h *APIHandler) GetDeadLetter(c *gin.Context) {
+	entry, err := h.Scheduler.GetDeadLetter(c.Param("id"))
+	if err != nil {
+		deadLetterError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// RequeueDeadLetter godoc
+// @Summary Requeue a dead-lettered task
+// @Description Resets the task's attempts, puts it back on the queue and removes the entry
+// @Tags DeadLetters
+// @Produce json
+// @Param id path string true "Dead-letter ID"
+// @Success 202 {object} scheduler.Task
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/dead-letters/{id}/requeue [post]
+func (h *APIHandler) RequeueDeadLetter(c *gin.Context) {
+	task, err := h.Scheduler.RequeueDeadLetter(c.Param("id"))
+	if err != nil {
+		deadLetterError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, task)
+}
+
+// DeleteDeadLetter godoc
+// @Summary Purge a dead-lettered task
+// @Description Removes a single entry without requeueing its task
+// @Tags DeadLetters
+// @Param id path string true "Dead-letter ID"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/dead-letters/{id} [delete]
+func (h *APIHandler) DeleteDeadLetter(c *gin.Context) {
+	if err := h.Scheduler.DeleteDeadLetter(c.Param("id")); err != nil {
+		deadLetterError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// PurgeDeadLetters godoc
+// @Summary Purge all dead-lettered tasks
+// @Description Removes every entry from the dead-letter queue
+// @Tags DeadLetters
+// @Produce json
+// @Success 200 {object} map[string]int64
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/dead-letters [delete]
+func (h *APIHandler) PurgeDeadLetters(c *gin.Context) {
+	n, err := h.Scheduler.PurgeDeadLetters()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"purged": n})
+}
+
+func deadLetterError(c *gin.Context, err error) {
+	if errors.Is(err, scheduler.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "dead letter not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -1,37 +1,102 @@
 package api
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"distributed-task-scheduler/internal/scheduler"
+	"distributed-task-scheduler/pkg/labels"
+	"distributed-task-scheduler/pkg/models"
+	"distributed-task-scheduler/pkg/repositories"
 	"github.com/gin-gonic/gin"
 )
 
 // TaskRequest represents the request payload for a new task
 type TaskRequest struct {
-	Priority string      `json:"priority" binding:"required" example:"high"`
-	Payload  interface{} `json:"payload" binding:"required"`
+	Type     string            `json:"type" binding:"required" example:"echo"`
+	Priority PriorityValue     `json:"priority" binding:"required" example:"high"` // high, medium, low or 0-1000; lower runs first
+	Payload  interface{}       `json:"payload" binding:"required"`
+	Labels   map[string]string `json:"labels"` // e.g. {"tenant": "acme", "run": "2024-06-01"}
+	Retry    *RetryRequest     `json:"retry"`
+	RunAt    *time.Time        `json:"run_at" example:"2030-01-01T03:00:00Z"` // run at this time (RFC 3339)
+	Delay    string            `json:"delay" example:"10m"`                   // or run after this delay
+	Timeout  string            `json:"timeout" example:"30s"`                 // limit per attempt; defaults per priority
+	// IdempotencyKey makes retried submissions return the original task; the Idempotency-Key header works too
+	IdempotencyKey string `json:"idempotency_key" example:"order-1234-invoice"`
+}
+
+// RetryRequest overrides parts of the default retry policy for the task's priority
+type RetryRequest struct {
+	MaxAttempts    *int     `json:"max_attempts" example:"3"`
+	InitialBackoff string   `json:"initial_backoff" example:"2s"`
+	Multiplier     *float64 `json:"multiplier" example:"2"`
+	MaxBackoff     string   `json:"max_backoff" example:"1m"`
+	Jitter         *float64 `json:"jitter" example:"0.2"`
+}
+
+// policy merges the request over the priority default and validates the result
+func (r *RetryRequest) policy(priority scheduler.TaskPriority) (scheduler.RetryPolicy, error) {
+	policy := scheduler.DefaultRetryPolicy(priority)
+	if r.MaxAttempts != nil {
+		policy.MaxAttempts = *r.MaxAttempts
+	}
+	if r.InitialBackoff != "" {
+		d, err := time.ParseDuration(r.InitialBackoff)
+		if err != nil {
+			return policy, fmt.Errorf("invalid initial_backoff: %w", err)
+		}
+		policy.InitialBackoff = d
+	}
+	if r.Multiplier != nil {
+		policy.Multiplier = *r.Multiplier
+	}
+	if r.MaxBackoff != "" {
+		d, err := time.ParseDuration(r.MaxBackoff)
+		if err != nil {
+			return policy, fmt.Errorf("invalid max_backoff: %w", err)
+		}
+		policy.MaxBackoff = d
+	}
+	if r.Jitter != nil {
+		policy.Jitter = *r.Jitter
+	}
+	return policy, policy.Validate()
 }
 
 // APIHandler wraps dependencies like the scheduler
 type APIHandler struct {
 	Scheduler *scheduler.TaskScheduler
+	Nodes     *repositories.NodeRepository
 }
 
 // NewAPIHandler returns an initialized handler
-func NewAPIHandler(s *scheduler.TaskScheduler) *APIHandler {
-	return &APIHandler{Scheduler: s}
+func NewAPIHandler(s *scheduler.TaskScheduler, nodes *repositories.NodeRepository) *APIHandler {
+	return &APIHandler{Scheduler: s, Nodes: nodes}
 }
 
 // SubmitTask godoc
 // @Summary Submit a new task
-// @Description Submit a task with priority and JSON payload
+// @Description Submit a task with a type, priority and JSON payload. Retry settings not given fall back to the defaults for the priority. Set run_at or delay to hold the task until then. Attempts running longer than timeout end as timed_out and are retried like failures. Repeating a submission with the same idempotency key returns the original task with 200; reusing the key for a different request is a 409. A full queue answers 429 with Retry-After.
 // @Tags Tasks
 // @Accept json
 // @Produce json
 // @Param task body TaskRequest true "Task to submit"
+// @Param Idempotency-Key header string false "Idempotency key"
+// @Success 200 {object} scheduler.Task
 // @Success 202 {object} scheduler.Task
 // @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 500 {object} map[string]string
 // @Router /api/v1/tasks [post]
 func (h *APIHandler) SubmitTask(c *gin.Context) {
 	var req TaskRequest
@@ -40,23 +105,138 @@ func (h *APIHandler) SubmitTask(c *gin.Context) {
 		return
 	}
 
-	var priority scheduler.TaskPriority
-	switch req.Priority {
-	case "high":
-		priority = scheduler.High
-	case "medium":
-		priority = scheduler.Medium
-	case "low":
-		priority = scheduler.Low
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid priority (must be high, medium, or low)"})
+	spec, err := req.spec()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	task := h.Scheduler.SubmitTask(priority, req.Payload)
+	key := c.GetHeader("Idempotency-Key")
+	if req.IdempotencyKey != "" {
+		if key != "" && key != req.IdempotencyKey {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key header and idempotency_key field differ"})
+			return
+		}
+		key = req.IdempotencyKey
+	}
+	if key != "" {
+		task, created, err := h.Scheduler.SubmitTaskWithKey(spec, key, req.fingerprint())
+		switch {
+		case errors.Is(err, scheduler.ErrConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, scheduler.ErrQueueFull):
+			h.queueFull(c, err)
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store task: " + err.Error()})
+		case created:
+			c.JSON(http.StatusAccepted, task)
+		default:
+			c.JSON(http.StatusOK, task)
+		}
+		return
+	}
+
+	task, err := h.Scheduler.SubmitTask(spec)
+	if errors.Is(err, scheduler.ErrQueueFull) {
+		h.queueFull(c, err)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store task: " + err.Error()})
+		return
+	}
 	c.JSON(http.StatusAccepted, task)
 }
 
+// spec validates the request and turns it into a scheduler TaskSpec
+func (req *TaskRequest) spec() (scheduler.TaskSpec, error) {
+	priority, ok := parsePriority(string(req.Priority))
+	if !ok {
+		return scheduler.TaskSpec{}, errInvalidPriority
+	}
+
+	spec := scheduler.TaskSpec{
+		Type:     req.Type,
+		Priority: priority,
+		Payload:  req.Payload,
+	}
+	if err := labels.Validate(req.Labels); err != nil {
+		return spec, err
+	}
+	spec.Labels = req.Labels
+	if req.Retry != nil {
+		policy, err := req.Retry.policy(priority)
+		if err != nil {
+			return spec, errors.New("invalid retry policy: " + err.Error())
+		}
+		spec.Retry = &policy
+	}
+
+	if req.Timeout != "" {
+		timeout, err := time.ParseDuration(req.Timeout)
+		if err != nil || timeout <= 0 {
+			return spec, errors.New("invalid timeout (expected a positive duration like 30s)")
+		}
+		spec.Timeout = timeout
+	}
+
+	switch {
+	case req.RunAt != nil && req.Delay != "":
+		return spec, errors.New("run_at and delay are mutually exclusive")
+	case req.RunAt != nil:
+		spec.RunAt = req.RunAt
+	case req.Delay != "":
+		delay, err := time.ParseDuration(req.Delay)
+		if err != nil || delay < 0 {
+			return spec, errors.New("invalid delay (expected a non-negative duration like 10m)")
+		}
+		runAt := time.Now().UTC().Add(delay)
+		spec.RunAt = &runAt
+	}
+	return spec, nil
+}
+
+// fingerprint hashes what the request asks for, so a reused idempotency key
+// can be told apart from a retry of the same request
+func (req TaskRequest) fingerprint() string {
+	req.IdempotencyKey = ""
+	body, _ := json.Marshal(req)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// queueFull tells the client to back off for the scheduler's Retry-After, in whole seconds
+func (h *APIHandler) queueFull(c *gin.Context, err error) {
+	retryAfter := int(math.Ceil(h.Scheduler.QueueRetryAfter().Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+}
+
+// errInvalidPriority is the response to a priority ParsePriority rejects
+var errInvalidPriority = errors.New("invalid priority (must be high, medium, low or a number from 0 to 1000)")
+
+// PriorityValue is a priority as a JSON string ("high", "750") or number (750)
+type PriorityValue string
+
+func (p *PriorityValue) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*p = PriorityValue(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return errInvalidPriority
+	}
+	*p = PriorityValue(n.String())
+	return nil
+}
+
+// parsePriority reads a priority name or number; lower numbers run first
+func parsePriority(s string) (scheduler.TaskPriority, bool) {
+	return scheduler.ParsePriority(strings.TrimSpace(s))
+}
+
 // GetTask godoc
 // @Summary Get task by ID
 // @Description Returns task status
@@ -65,7 +245,7 @@ func (h *APIHandler) SubmitTask(c *gin.Context) {
 // @Param id path string true "Task ID"
 // @Success 200 {object} scheduler.Task
 // @Failure 404 {object} map[string]string
-// @Router /tasks/{id} [get]
+// @Router /api/v1/tasks/{id} [get]
 func (h *APIHandler) GetTask(c *gin.Context) {
 	id := c.Param("id")
 	task, exists := h.Scheduler.GetTask(id)
@@ -76,14 +256,309 @@ func (h *APIHandler) GetTask(c *gin.Context) {
 	c.JSON(http.StatusOK, task)
 }
 
-// GetAllTasks godoc
-// @Summary Get all tasks
-// @Description Returns a list of all tasks
+// Bounds of the timeout a client may wait for a task result
+const (
+	defaultResultWait = 30 * time.Second
+	maxResultWait     = 5 * time.Minute
+)
+
+// GetTaskResult godoc
+// @Summary Wait for a task's result
+// @Description Long-polls until the task has reached a final status or the timeout (default 30s, at most 5m) expires. Returns 200 with the finished task, or 202 with its current state if it is still in progress.
 // @Tags Tasks
 // @Produce json
-// @Success 200 {array} scheduler.Task
+// @Param id path string true "Task ID"
+// @Param timeout query string false "How long to wait, e.g. 10s"
+// @Success 200 {object} scheduler.Task
+// @Success 202 {object} scheduler.Task
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/tasks/{id}/result [get]
+func (h *APIHandler) GetTaskResult(c *gin.Context) {
+	wait := defaultResultWait
+	if v := c.Query("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid timeout (expected a non-negative duration like 10s)"})
+			return
+		}
+		wait = min(d, maxResultWait)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), wait)
+	defer cancel()
+
+	task, finished, err := h.Scheduler.WaitForResult(ctx, c.Param("id"))
+	switch {
+	case errors.Is(err, scheduler.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	case finished:
+		c.JSON(http.StatusOK, task)
+	default:
+		c.JSON(http.StatusAccepted, task)
+	}
+}
+
+// TaskPatchRequest lists the fields of a task that can be changed after submission
+type TaskPatchRequest struct {
+	Priority PriorityValue `json:"priority" binding:"required" example:"high"`
+}
+
+// UpdateTask godoc
+// @Summary Change a task's priority
+// @Description Changes the priority of a pending or blocked task; a queued task moves to its new place in the queue right away. The change is recorded in the task's history.
+// @Tags Tasks
+// @Accept json
+// @Produce json
+// @Param id path string true "Task ID"
+// @Param task body TaskPatchRequest true "New priority"
+// @Success 200 {object} scheduler.Task
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/tasks/{id} [patch]
+func (h *APIHandler) UpdateTask(c *gin.Context) {
+	var req TaskPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	priority, ok := parsePriority(string(req.Priority))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidPriority.Error()})
+		return
+	}
+
+	task, err := h.Scheduler.SetPriority(c.Param("id"), priority)
+	switch {
+	case errors.Is(err, scheduler.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+	case errors.Is(err, scheduler.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, task)
+	}
+}
+
+// CancelTask godoc
+// @Summary Cancel a task
+// @Description Cancels a pending task right away (200). A running task is asked to stop (202); it ends up cancelled once the node running it has aborted its handler.
+// @Tags Tasks
+// @Produce json
+// @Param id path string true "Task ID"
+// @Success 200 {object} scheduler.Task
+// @Success 202 {object} scheduler.Task
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/tasks/{id}/cancel [post]
+func (h *APIHandler) CancelTask(c *gin.Context) {
+	task, err := h.Scheduler.CancelTask(c.Param("id"))
+	switch {
+	case errors.Is(err, scheduler.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+	case errors.Is(err, scheduler.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	case task.CancelRequested:
+		c.JSON(http.StatusAccepted, task)
+	default:
+		c.JSON(http.StatusOK, task)
+	}
+}
+
+// CancelTasks godoc
+// @Summary Cancel matching tasks
+// @Description Cancels every unfinished task matching the filter, like POST /tasks/{id}/cancel does for one. At least one filter is required.
+// @Tags Tasks
+// @Produce json
+// @Param status query string false "Statuses, e.g. pending,running"
+// @Param priority query string false "Priorities, e.g. high,250"
+// @Param type query string false "Task types"
+// @Param created_after query string false "RFC 3339 time, inclusive"
+// @Param created_before query string false "RFC 3339 time, exclusive"
+// @Param selector query string false "Label selector, e.g. env=prod,team in (a,b),!legacy"
+// @Success 200 {object} map[string]int
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/tasks/cancel [post]
+func (h *APIHandler) CancelTasks(c *gin.Context) {
+	filter, ok := bulkFilter(c)
+	if !ok {
+		return
+	}
+	cancelled, requested, err := h.Scheduler.CancelTasks(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"cancelled": cancelled, "cancel_requested": requested})
+}
+
+// DeleteTasks godoc
+// @Summary Delete matching tasks
+// @Description Deletes the finished tasks matching the filter; unfinished ones are left alone. At least one filter is required.
+// @Tags Tasks
+// @Produce json
+// @Param status query string false "Statuses, e.g. completed,failed"
+// @Param priority query string false "Priorities, e.g. high,250"
+// @Param type query string false "Task types"
+// @Param created_after query string false "RFC 3339 time, inclusive"
+// @Param created_before query string false "RFC 3339 time, exclusive"
+// @Param selector query string false "Label selector, e.g. env=prod,team in (a,b),!legacy"
+// @Success 200 {object} map[string]int
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/tasks [delete]
+func (h *APIHandler) DeleteTasks(c *gin.Context) {
+	filter, ok := bulkFilter(c)
+	if !ok {
+		return
+	}
+	n, err := h.Scheduler.DeleteTasks(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": n})
+}
+
+// bulkFilter reads the filter of a bulk operation, which must not match
+// every task by accident
+func bulkFilter(c *gin.Context) (repositories.TaskFilter, bool) {
+	filter, err := parseTaskFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return filter, false
+	}
+	if filter.IsEmpty() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a filter or selector is required"})
+		return filter, false
+	}
+	return filter, true
+}
+
+// ListTasks godoc
+// @Summary List tasks
+// @Description Returns a page of tasks. Filters combine with AND; list filters take comma-separated values. Pass next_cursor from the response as cursor to get the next page.
+// @Tags Tasks
+// @Produce json
+// @Param status query string false "Statuses, e.g. pending,running"
+// @Param priority query string false "Priorities, e.g. high,250"
+// @Param type query string false "Task types"
+// @Param created_after query string false "RFC 3339 time, inclusive"
+// @Param created_before query string false "RFC 3339 time, exclusive"
+// @Param selector query string false "Label selector, e.g. env=prod,team in (a,b),!legacy"
+// @Param sort query string false "created_at or priority; prefix with - for descending" default(created_at)
+// @Param limit query int false "Page size, at most 1000" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param include_total query bool false "Also count all matching tasks"
+// @Success 200 {object} scheduler.TaskList
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
 // @Router /api/v1/tasks [get]
-func (h *APIHandler) GetAllTasks(c *gin.Context) {
-	tasks := h.Scheduler.GetAllTasks()
-	c.JSON(http.StatusOK, tasks)
+func (h *APIHandler) ListTasks(c *gin.Context) {
+	q, err := parseTaskQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	list, err := h.Scheduler.ListTasks(q)
+	switch {
+	case errors.Is(err, scheduler.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// parseTaskQuery reads the listing parameters of ListTasks
+func parseTaskQuery(c *gin.Context) (repositories.TaskQuery, error) {
+	q := repositories.TaskQuery{
+		Cursor:    c.Query("cursor"),
+		WithTotal: c.Query("include_total") == "true",
+	}
+
+	filter, err := parseTaskFilter(c)
+	if err != nil {
+		return q, err
+	}
+	q.TaskFilter = filter
+
+	sort := c.DefaultQuery("sort", repositories.SortCreatedAt)
+	if strings.HasPrefix(sort, "-") {
+		q.Desc = true
+		sort = sort[1:]
+	}
+	switch sort {
+	case repositories.SortCreatedAt, repositories.SortPriority:
+		q.Sort = sort
+	default:
+		return q, errors.New("invalid sort (must be created_at or priority, optionally prefixed with -)")
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return q, errors.New("invalid limit (expected a positive integer)")
+		}
+		q.Limit = limit
+	}
+	return q, nil
+}
+
+// parseTaskFilter reads the filter parameters shared by task listings and bulk operations
+func parseTaskFilter(c *gin.Context) (repositories.TaskFilter, error) {
+	var f repositories.TaskFilter
+	f.Statuses = splitList(c.Query("status"))
+	f.Types = splitList(c.Query("type"))
+	for _, name := range splitList(c.Query("priority")) {
+		priority, ok := parsePriority(name)
+		if !ok {
+			return f, errInvalidPriority
+		}
+		f.Priorities = append(f.Priorities, models.TaskPriority(priority))
+	}
+	var err error
+	if f.CreatedAfter, err = timeQuery(c, "created_after"); err != nil {
+		return f, err
+	}
+	if f.CreatedBefore, err = timeQuery(c, "created_before"); err != nil {
+		return f, err
+	}
+	if f.Labels, err = labels.Parse(c.Query("selector")); err != nil {
+		return f, fmt.Errorf("invalid selector: %v", err)
+	}
+	return f, nil
+}
+
+// timeQuery reads an optional RFC 3339 query parameter
+func timeQuery(c *gin.Context, param string) (*time.Time, error) {
+	v := c.Query(param)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s (expected an RFC 3339 time)", param)
+	}
+	return &t, nil
+}
+
+// splitList splits a comma-separated query value, dropping empty items
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"distributed-task-scheduler/internal/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// OperationRequest names the action of a bulk operation; the tasks it applies
+// to are selected with the same query parameters as GET /tasks
+type OperationRequest struct {
+	Action   string        `json:"action" binding:"required" example:"requeue"` // cancel, requeue, set_priority or delete
+	Priority PriorityValue `json:"priority" example:"high"`                     // new priority, for set_priority only
+}
+
+// StartOperation godoc
+// @Summary Start a bulk operation
+// @Description Applies one action to every task matching the filter, in the background: cancel unfinished tasks, requeue failed and timed-out ones, set_priority of pending and blocked ones, or delete finished ones. At least one filter is required. Poll the returned operation for progress.
+// @Tags Operations
+// @Accept json
+// @Produce json
+// @Param operation body OperationRequest true "Action to apply"
+// @Param status query string false "Statuses, e.g. failed,timed_out"
+// @Param priority query string false "Priorities, e.g. high,250"
+// @Param type query string false "Task types"
+// @Param created_after query string false "RFC 3339 time, inclusive"
+// @Param created_before query string false "RFC 3339 time, exclusive"
+// @Param selector query string false "Label selector, e.g. env=prod,team in (a,b),!legacy"
+// @Success 202 {object} models.Operation
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/tasks/bulk [post]
+func (h *APIHandler) StartOperation(c *gin.Context) {
+	var req OperationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter, ok := bulkFilter(c)
+	if !ok {
+		return
+	}
+
+	spec := scheduler.OperationSpec{Action: req.Action, Filter: filter}
+	if req.Priority != "" {
+		priority, ok := parsePriority(string(req.Priority))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidPriority.Error()})
+			return
+		}
+		spec.Priority = &priority
+	}
+
+	op, err := h.Scheduler.StartOperation(spec)
+	if err != nil {
+		operationError(c, err)
+		return
+	}
+	c.Header("Location", "/api/v1/operations/"+op.ID)
+	c.JSON(http.StatusAccepted, op)
+}
+
+// GetOperation godoc
+// @Summary Get a bulk operation
+// @Description Returns the status and progress of a bulk operation. matched is the number of tasks the filter selected when it started; processed counts those looked at so far and affected those the action applied to.
+// @Tags Operations
+// @Produce json
+// @Param id path string true "Operation ID"
+// @Success 200 {object} models.Operation
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/operations/{id} [get]
+func (h *APIHandler) GetOperation(c *gin.Context) {
+	op, err := h.Scheduler.GetOperation(c.Param("id"))
+	if err != nil {
+		operationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, op)
+}
+
+func operationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, scheduler.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "operation not found"})
+	case errors.Is(err, scheduler.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
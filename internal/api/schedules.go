@@ -0,0 +1,120 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"distributed-task-scheduler/internal/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// ScheduleRequest represents the request payload for a new recurring task
+type ScheduleRequest struct {
+	Name     string        `json:"name" example:"nightly-report"`
+	Cron     string        `json:"cron" binding:"required" example:"0 3 * * *"`
+	Timezone string        `json:"timezone" example:"Europe/Berlin"`
+	Type     string        `json:"type" binding:"required" example:"echo"`
+	Priority PriorityValue `json:"priority" binding:"required" example:"low"`
+	Payload  interface{}   `json:"payload"`
+	CatchUp  string        `json:"catch_up" example:"last"` // none, last or all
+}
+
+// CreateSchedule godoc
+// @Summary Create a recurring task
+// @Description Stores a cron schedule; the leader submits a task for every firing. String values in the payload may use {{.ScheduleID}}, {{.ScheduleName}} and {{.FireTime}}.
+// @Tags Schedules
+// @Accept json
+// @Produce json
+// @Param schedule body ScheduleRequest true "Schedule to create"
+// @Success 201 {object} models.Schedule
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/schedules [post]
+func (h *APIHandler) CreateSchedule(c *gin.Context) {
+	var req ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	priority, ok := parsePriority(string(req.Priority))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidPriority.Error()})
+		return
+	}
+
+	schedule, err := h.Scheduler.CreateSchedule(scheduler.ScheduleSpec{
+		Name:     req.Name,
+		Cron:     req.Cron,
+		Timezone: req.Timezone,
+		Type:     req.Type,
+		Priority: priority,
+		Payload:  req.Payload,
+		CatchUp:  req.CatchUp,
+	})
+	if err != nil {
+		scheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, schedule)
+}
+
+// ListSchedules godoc
+// @Summary List recurring tasks
+// @Tags Schedules
+// @Produce json
+// @Success 200 {array} models.Schedule
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/schedules [get]
+func (h *APIHandler) ListSchedules(c *gin.Context) {
+	schedules, err := h.Scheduler.ListSchedules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, schedules)
+}
+
+// GetSchedule godoc
+// @Summary Get a recurring task
+// @Description Returns the schedule including the time it last fired
+// @Tags Schedules
+// @Produce json
+// @Param id path string true "Schedule ID"
+// @Success 200 {object} models.Schedule
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/schedules/{id} [get]
+func (h *APIHandler) GetSchedule(c *gin.Context) {
+	schedule, err := h.Scheduler.GetSchedule(c.Param("id"))
+	if err != nil {
+		scheduleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, schedule)
+}
+
+// DeleteSchedule godoc
+// @Summary Delete a recurring task
+// @Description Stops future firings; tasks already submitted are kept
+// @Tags Schedules
+// @Param id path string true "Schedule ID"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/schedules/{id} [delete]
+func (h *APIHandler) DeleteSchedule(c *gin.Context) {
+	if err := h.Scheduler.DeleteSchedule(c.Param("id")); err != nil {
+		scheduleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func scheduleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, scheduler.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, scheduler.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "schedule not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
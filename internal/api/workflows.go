@@ -0,0 +1,97 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"distributed-task-scheduler/internal/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// WorkflowRequest represents the request payload for a new workflow
+type WorkflowRequest struct {
+	Name  string                `json:"name" example:"nightly-etl"`
+	Tasks []WorkflowTaskRequest `json:"tasks" binding:"required,dive"`
+}
+
+// WorkflowTaskRequest is a task of a workflow; depends_on names parent tasks by key
+type WorkflowTaskRequest struct {
+	TaskRequest
+	Key       string                 `json:"key" binding:"required" example:"extract"`
+	DependsOn []scheduler.Dependency `json:"depends_on"`
+}
+
+// SubmitWorkflow godoc
+// @Summary Submit a workflow
+// @Description Submits tasks connected by depends_on edges. A task runs once all of its parents have finished; a parent that doesn't complete skips the child, fails it, or lets it run anyway, as set by the edge's on_failure (skip, fail or run; default fail). Cyclic graphs are rejected. If the tasks that can run right away don't fit in the queue, nothing is stored and the answer is 429 with Retry-After.
+// @Tags Workflows
+// @Accept json
+// @Produce json
+// @Param workflow body WorkflowRequest true "Workflow to submit"
+// @Success 202 {object} scheduler.Workflow
+// @Failure 400 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/workflows [post]
+func (h *APIHandler) SubmitWorkflow(c *gin.Context) {
+	var req WorkflowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	spec := scheduler.WorkflowSpec{Name: req.Name}
+	for i := range req.Tasks {
+		task, err := req.Tasks[i].spec()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("task %q: %v", req.Tasks[i].Key, err)})
+			return
+		}
+		spec.Tasks = append(spec.Tasks, scheduler.WorkflowTaskSpec{
+			Key:       req.Tasks[i].Key,
+			Task:      task,
+			DependsOn: req.Tasks[i].DependsOn,
+		})
+	}
+
+	workflow, err := h.Scheduler.SubmitWorkflow(spec)
+	if errors.Is(err, scheduler.ErrQueueFull) {
+		h.queueFull(c, err)
+		return
+	}
+	if err != nil {
+		workflowError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, workflow)
+}
+
+// GetWorkflow godoc
+// @Summary Get a workflow
+// @Description Returns the workflow graph with the status of each task
+// @Tags Workflows
+// @Produce json
+// @Param id path string true "Workflow ID"
+// @Success 200 {object} scheduler.Workflow
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/workflows/{id} [get]
+func (h *APIHandler) GetWorkflow(c *gin.Context) {
+	workflow, err := h.Scheduler.GetWorkflow(c.Param("id"))
+	if err != nil {
+		workflowError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, workflow)
+}
+
+func workflowError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, scheduler.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "workflow not found"})
+	case errors.Is(err, scheduler.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -4,35 +4,73 @@ import (
 	"log"
 	"sync"
 	"time"
+
+	"distributed-task-scheduler/pkg/models"
+	"distributed-task-scheduler/pkg/repositories"
 )
 
+// HeartbeatConfig controls how a node reports itself to the cluster
+type HeartbeatConfig struct {
+	Address     string        // where operators and other nodes reach this node
+	Interval    time.Duration // time between heartbeats
+	MissedBeats int           // intervals without a heartbeat before the leader marks a node dead
+}
+
 // Heartbeater Heartbeat sends periodic liveness signals.
 type Heartbeater struct {
-	interval time.Duration
-	stopChan chan struct{}
-	NodeID   string
-	once     sync.Once
+	interval    time.Duration
+	stopChan    chan struct{}
+	NodeID      string
+	once        sync.Once
+	address     string
+	missedBeats int
+	startedAt   time.Time
+	nodes       *repositories.NodeRepository
+	elector     Elector
+	stats       func() (workers, running int)
+	started     bool
+	done        chan struct{}
 }
 
-// NewHeartbeater creates a heartbeat sender.
-func NewHeartbeater(nodeID string, interval time.Duration) *Heartbeater {
+// NewHeartbeater creates a heartbeat sender. stats reports the node's worker
+// count and how many tasks it is running.
+func NewHeartbeater(nodeID string, cfg HeartbeatConfig, nodes *repositories.NodeRepository, elector Elector, stats func() (workers, running int)) *Heartbeater {
+	if cfg.MissedBeats < 1 {
+		cfg.MissedBeats = 3
+	}
 	return &Heartbeater{
-		interval: interval,
-		stopChan: make(chan struct{}),
-		NodeID:   nodeID,
+		interval:    cfg.Interval,
+		stopChan:    make(chan struct{}),
+		NodeID:      nodeID,
+		address:     cfg.Address,
+		missedBeats: cfg.MissedBeats,
+		startedAt:   time.Now().UTC(),
+		nodes:       nodes,
+		elector:     elector,
+		stats:       stats,
+		done:        make(chan struct{}),
 	}
 }
 
 // Start begins sending heartbeats.
 func (hb *Heartbeater) Start() {
 	ticker := time.NewTicker(hb.interval)
+	hb.started = true
+	hb.beat()
 	go func() {
+		defer close(hb.done)
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				log.Printf("[Heartbeat] Node %s is alive", hb.NodeID)
+				hb.beat()
+				if hb.elector.IsCurrentLeader() {
+					hb.detectDeadNodes()
+				}
 			case <-hb.stopChan:
+				if err := hb.nodes.SetStatus(hb.NodeID, models.NodeStopped); err != nil {
+					log.Printf("[Heartbeat] Failed to deregister node %s: %v", hb.NodeID, err)
+				}
 				log.Printf("[Heartbeat] Node %s stopped", hb.NodeID)
 				return
 			}
@@ -40,9 +78,39 @@ func (hb *Heartbeater) Start() {
 	}()
 }
 
-// Stop signals the heartbeat loop to exit.
+// Stop signals the heartbeat loop to exit and waits for the node to deregister.
 func (hb *Heartbeater) Stop() {
 	hb.once.Do(func() {
 		close(hb.stopChan)
 	})
+	if hb.started {
+		<-hb.done
+	}
+}
+
+func (hb *Heartbeater) beat() {
+	workers, running := hb.stats()
+	node := &models.Node{
+		ID:          hb.NodeID,
+		Address:     hb.address,
+		StartedAt:   hb.startedAt,
+		LastSeenAt:  time.Now().UTC(),
+		WorkerCount: workers,
+		Load:        running,
+	}
+	if err := hb.nodes.Heartbeat(node); err != nil {
+		log.Printf("[Heartbeat] Node %s failed to record heartbeat: %v", hb.NodeID, err)
+	}
+}
+
+// detectDeadNodes runs on the leader and flags nodes that missed too many heartbeats
+func (hb *Heartbeater) detectDeadNodes() {
+	dead, err := hb.nodes.MarkDead(time.Duration(hb.missedBeats) * hb.interval)
+	if err != nil {
+		log.Printf("[Heartbeat] Failed to check for dead nodes: %v", err)
+		return
+	}
+	for _, id := range dead {
+		log.Printf("[Heartbeat] Node %s missed %d heartbeats, marked dead", id, hb.missedBeats)
+	}
 }
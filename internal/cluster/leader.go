@@ -2,32 +2,83 @@ package cluster
 
 import (
 	"log"
-	"math/rand"
 	"os"
 	"sync"
 	"time"
+
+	"github.com/google/uuid"
 )
 
+// electionInterval is how often leadership is campaigned for or renewed
+const electionInterval = 3 * time.Second
+
+// Elector is what the rest of the node needs from leader election
+type Elector interface {
+	Start()
+	Stop()
+	// Campaign runs one election round, taking or renewing leadership if possible
+	Campaign() error
+	// Resign gives up leadership if this node holds it
+	Resign() error
+	// Leader returns the ID of the node leading the cluster, "" if there is none
+	Leader() (string, error)
+	IsCurrentLeader() bool
+	// FencingToken identifies the current term while this node leads, 0 otherwise
+	FencingToken() int64
+	// OnLeadershipChange registers fn to be called whenever this node gains or loses leadership
+	OnLeadershipChange(fn func(isLeader bool))
+}
+
+// ElectionBackend stores who holds leadership
+type ElectionBackend interface {
+	// Campaign takes or renews leadership for nodeID for ttl. It reports whether
+	// nodeID is leader and the fencing token of its term.
+	Campaign(nodeID string, ttl time.Duration) (bool, int64, error)
+	// Resign releases leadership if nodeID holds it
+	Resign(nodeID string) error
+	// Leader returns the current leader's node ID, "" if leadership is vacant
+	Leader() (string, error)
+}
+
 // LeaderElector handles leader election and role switching
 type LeaderElector struct {
-	NodeID      string
-	IsLeader    bool
-	leaderMutex sync.RWMutex
-	stopChan    chan struct{}
-	callback    func() // Called when this node becomes leader
+	NodeID       string
+	IsLeader     bool
+	fencingToken int64
+	leaderMutex  sync.RWMutex
+	stopChan     chan struct{}
+	stopOnce     sync.Once
+	backend      ElectionBackend
+	leaseTTL     time.Duration // how long leadership lasts without renewal
+	callbacks    []func(isLeader bool)
+	cbMutex      sync.Mutex
 }
 
-// NewLeaderElector creates a new leader instance
-func NewLeaderElector(onLeadershipGained func()) *LeaderElector {
-	nodeID := os.Getenv("NODE_ID")
-	if nodeID == "" {
-		nodeID = generateRandomNodeID()
+var _ Elector = (*LeaderElector)(nil)
+
+// NewLeaderElector creates an elector for nodeID that campaigns against
+// backend every election interval. Leadership lapses after leaseTTL if the
+// holder stops renewing it.
+func NewLeaderElector(nodeID string, backend ElectionBackend, leaseTTL time.Duration) *LeaderElector {
+	if leaseTTL <= electionInterval {
+		log.Printf("[Cluster] Lease TTL %s must exceed the %s renewal interval, using %s", leaseTTL, electionInterval, 3*electionInterval)
+		leaseTTL = 3 * electionInterval
 	}
 	return &LeaderElector{
 		NodeID:   nodeID,
 		stopChan: make(chan struct{}),
-		callback: onLeadershipGained,
+		backend:  backend,
+		leaseTTL: leaseTTL,
+	}
+}
+
+// NodeIDFromEnv returns NODE_ID, or a random ID when it isn't set
+func NodeIDFromEnv() string {
+	nodeID := os.Getenv("NODE_ID")
+	if nodeID == "" {
+		nodeID = generateRandomNodeID()
 	}
+	return nodeID
 }
 
 // Start begins the election loop
@@ -36,44 +87,90 @@ func (le *LeaderElector) Start() {
 	log.Printf("[Cluster] Node %s starting leader election loop", le.NodeID)
 }
 
-// Stop shuts down election
+// Stop shuts down election and gives up leadership if this node holds it
 func (le *LeaderElector) Stop() {
-	close(le.stopChan)
+	le.stopOnce.Do(func() {
+		close(le.stopChan)
+	})
 }
 
 func (le *LeaderElector) runElectionLoop() {
-	ticker := time.NewTicker(3 * time.Second)
+	ticker := time.NewTicker(electionInterval)
 	defer ticker.Stop()
 
+	le.Campaign()
 	for {
 		select {
 		case <-le.stopChan:
+			le.Resign()
 			return
 		case <-ticker.C:
-			le.electLeader()
+			le.Campaign()
 		}
 	}
 }
 
-// Simulated leader election
-func (le *LeaderElector) electLeader() {
-	// TODO: Replace with etcd/raft/redis lock
-	isLeader := rand.Intn(3) == 1 // 1 in 3 chance
-	le.setLeadership(isLeader)
+// Campaign runs one election round against the backend
+func (le *LeaderElector) Campaign() error {
+	isLeader, token, err := le.backend.Campaign(le.NodeID, le.leaseTTL)
+	if err != nil {
+		// We can't prove we still lead, so stop acting as leader
+		log.Printf("[Leader] Node %s failed to campaign: %v", le.NodeID, err)
+		le.setLeadership(false, 0)
+		return err
+	}
+	le.setLeadership(isLeader, token)
+	return nil
+}
+
+// Resign releases leadership so another node can take over without waiting
+// for the lease to expire
+func (le *LeaderElector) Resign() error {
+	if !le.IsCurrentLeader() {
+		return nil
+	}
+	err := le.backend.Resign(le.NodeID)
+	if err != nil {
+		log.Printf("[Leader] Node %s failed to resign: %v", le.NodeID, err)
+	}
+	le.setLeadership(false, 0)
+	return err
 }
 
-func (le *LeaderElector) setLeadership(isLeader bool) {
+// Leader returns the node currently leading the cluster
+func (le *LeaderElector) Leader() (string, error) {
+	return le.backend.Leader()
+}
+
+// OnLeadershipChange registers a callback for leadership transitions of this node
+func (le *LeaderElector) OnLeadershipChange(fn func(isLeader bool)) {
+	le.cbMutex.Lock()
+	defer le.cbMutex.Unlock()
+	le.callbacks = append(le.callbacks, fn)
+}
+
+func (le *LeaderElector) setLeadership(isLeader bool, token int64) {
 	le.leaderMutex.Lock()
-	defer le.leaderMutex.Unlock()
-
-	if le.IsLeader != isLeader {
-		le.IsLeader = isLeader
-		if isLeader {
-			log.Printf("[Leader] Node %s became leader", le.NodeID)
-			le.callback()
-		} else {
-			log.Printf("[Leader] Node %s is now a follower", le.NodeID)
-		}
+	changed := le.IsLeader != isLeader
+	le.IsLeader = isLeader
+	le.fencingToken = token
+	le.leaderMutex.Unlock()
+
+	if !changed {
+		return
+	}
+	if isLeader {
+		log.Printf("[Leader] Node %s became leader (fencing token %d)", le.NodeID, token)
+	} else {
+		log.Printf("[Leader] Node %s is now a follower", le.NodeID)
+	}
+
+	// Callbacks run without the state lock so they may query the elector
+	le.cbMutex.Lock()
+	callbacks := append([]func(bool){}, le.callbacks...)
+	le.cbMutex.Unlock()
+	for _, fn := range callbacks {
+		fn(isLeader)
 	}
 }
 
@@ -83,6 +180,15 @@ func (le *LeaderElector) IsCurrentLeader() bool {
 	return le.IsLeader
 }
 
+// FencingToken returns the token of the term this node leads, or 0 when it
+// isn't leader. Writes made on behalf of the leader can carry it so that a
+// deposed leader's late writes can be told apart.
+func (le *LeaderElector) FencingToken() int64 {
+	le.leaderMutex.RLock()
+	defer le.leaderMutex.RUnlock()
+	return le.fencingToken
+}
+
 func generateRandomNodeID() string {
-	return "node-" + time.Now().Format("150405") // fallback ID
+	return "node-" + uuid.New().String()[:8] // fallback ID
 }
@@ -0,0 +1,168 @@
+package cluster
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is advanced by hand so lease expiry doesn't depend on timing
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// randomBackend grants leadership with a 1 in 3 chance on every round,
+// independently per node, like the election this package replaced
+type randomBackend struct{}
+
+var _ ElectionBackend = randomBackend{}
+
+func (randomBackend) Campaign(nodeID string, ttl time.Duration) (bool, int64, error) {
+	return rand.Intn(3) == 1, 0, nil
+}
+
+func (randomBackend) Resign(nodeID string) error { return nil }
+
+// Leader is unknown because every node decides for itself
+func (randomBackend) Leader() (string, error) { return "", nil }
+
+func TestRandomElectionNotifiesChanges(t *testing.T) {
+	le := NewLeaderElector("node-a", randomBackend{}, 10*time.Second)
+	var gained, lost int
+	le.OnLeadershipChange(func(isLeader bool) {
+		if isLeader {
+			gained++
+		} else {
+			lost++
+		}
+	})
+	for i := 0; i < 200; i++ {
+		if err := le.Campaign(); err != nil {
+			t.Fatalf("Campaign failed: %v", err)
+		}
+	}
+	if gained == 0 || lost == 0 {
+		t.Fatalf("Expected leadership to be both gained and lost, got %d and %d", gained, lost)
+	}
+}
+
+func TestLeaderElectionFailover(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	backend := NewMemoryBackend(clock.Now)
+	ttl := 10 * time.Second
+
+	nodes := []*LeaderElector{
+		NewLeaderElector("node-a", backend, ttl),
+		NewLeaderElector("node-b", backend, ttl),
+		NewLeaderElector("node-c", backend, ttl),
+	}
+	changes := make(map[string][]bool)
+	for _, n := range nodes {
+		n := n
+		n.OnLeadershipChange(func(isLeader bool) {
+			changes[n.NodeID] = append(changes[n.NodeID], isLeader)
+		})
+	}
+
+	round := func() {
+		for _, n := range nodes {
+			if err := n.Campaign(); err != nil {
+				t.Fatalf("Campaign failed: %v", err)
+			}
+		}
+	}
+	leaders := func() []string {
+		var ids []string
+		for _, n := range nodes {
+			if n.IsCurrentLeader() {
+				ids = append(ids, n.NodeID)
+			}
+		}
+		return ids
+	}
+
+	round()
+	if got := leaders(); len(got) != 1 || got[0] != "node-a" {
+		t.Fatalf("Expected node-a to be the only leader, got %v", got)
+	}
+	if leader, _ := nodes[1].Leader(); leader != "node-a" {
+		t.Fatalf("Expected followers to observe node-a as leader, got %q", leader)
+	}
+	firstToken := nodes[0].FencingToken()
+
+	// Renewals keep the same leader and term
+	clock.Advance(5 * time.Second)
+	round()
+	if got := leaders(); len(got) != 1 || got[0] != "node-a" || nodes[0].FencingToken() != firstToken {
+		t.Fatalf("Expected node-a to keep leadership with token %d, got %v", firstToken, got)
+	}
+
+	// node-a resigns: the next campaigner takes over with a new term
+	if err := nodes[0].Resign(); err != nil {
+		t.Fatalf("Resign failed: %v", err)
+	}
+	nodes[1].Campaign()
+	nodes[2].Campaign()
+	if got := leaders(); len(got) != 1 || got[0] != "node-b" {
+		t.Fatalf("Expected node-b to take over after resignation, got %v", got)
+	}
+	if nodes[1].FencingToken() <= firstToken {
+		t.Fatalf("Expected the fencing token to grow, got %d after %d", nodes[1].FencingToken(), firstToken)
+	}
+
+	// node-b stops renewing (crash): nobody can take over until the lease expires
+	clock.Advance(ttl - time.Second)
+	nodes[2].Campaign()
+	if nodes[2].IsCurrentLeader() {
+		t.Fatalf("node-c took over before node-b's lease expired")
+	}
+	clock.Advance(2 * time.Second)
+	nodes[2].Campaign()
+	nodes[1].Campaign() // node-b comes back and finds it has been replaced
+	if got := leaders(); len(got) != 1 || got[0] != "node-c" {
+		t.Fatalf("Expected node-c to take over after expiry, got %v", got)
+	}
+
+	// Forced expiry hands leadership to whoever campaigns next
+	backend.Expire()
+	nodes[0].Campaign()
+	if got := leaders(); len(got) != 2 {
+		// node-c only notices on its next round
+		t.Fatalf("Expected node-a and stale node-c before node-c's next round, got %v", got)
+	}
+	nodes[2].Campaign()
+	if got := leaders(); len(got) != 1 || got[0] != "node-a" {
+		t.Fatalf("Expected node-a to lead after forced failover, got %v", got)
+	}
+
+	expect := map[string][]bool{
+		"node-a": {true, false, true},
+		"node-b": {true, false},
+		"node-c": {true, false},
+	}
+	for id, want := range expect {
+		got := changes[id]
+		if len(got) != len(want) {
+			t.Fatalf("%s: expected transitions %v, got %v", id, want, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("%s: expected transitions %v, got %v", id, want, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package cluster
+
+import (
+	"time"
+
+	"distributed-task-scheduler/pkg/models"
+	"gorm.io/gorm"
+)
+
+// leaseName identifies the scheduler's row in the leader lease table
+const leaseName = "scheduler"
+
+// PostgresBackend elects a leader through a lease row. Expiry is judged with
+// the database clock so nodes with skewed clocks still agree.
+type PostgresBackend struct {
+	db *gorm.DB
+}
+
+var _ ElectionBackend = (*PostgresBackend)(nil)
+
+func NewPostgresBackend(db *gorm.DB) *PostgresBackend {
+	return &PostgresBackend{db: db}
+}
+
+// Campaign takes the lease if it is free or expired, or renews it if nodeID
+// already holds it. The fencing token grows every time the lease changes hands.
+func (b *PostgresBackend) Campaign(nodeID string, ttl time.Duration) (bool, int64, error) {
+	var lease models.LeaderLease
+	res := b.db.Raw(`
+		INSERT INTO leader_leases (name, holder_id, fencing_token, expires_at, updated_at)
+		VALUES (?, ?, 1, now() + make_interval(secs => ?), now())
+		ON CONFLICT (name) DO UPDATE SET
+			holder_id     = EXCLUDED.holder_id,
+			fencing_token = CASE WHEN leader_leases.holder_id = EXCLUDED.holder_id
+			                     THEN leader_leases.fencing_token
+			                     ELSE leader_leases.fencing_token + 1 END,
+			expires_at    = EXCLUDED.expires_at,
+			updated_at    = EXCLUDED.updated_at
+		WHERE leader_leases.holder_id = EXCLUDED.holder_id OR leader_leases.expires_at < now()
+		RETURNING name, holder_id, fencing_token, expires_at, updated_at`,
+		leaseName, nodeID, ttl.Seconds(),
+	).Scan(&lease)
+	if res.Error != nil {
+		return false, 0, res.Error
+	}
+	if res.RowsAffected == 0 {
+		// Someone else holds an unexpired lease
+		return false, 0, nil
+	}
+	return lease.HolderID == nodeID, lease.FencingToken, nil
+}
+
+// Resign expires the lease right away if nodeID holds it
+func (b *PostgresBackend) Resign(nodeID string) error {
+	return b.db.Exec(
+		`UPDATE leader_leases SET expires_at = now() WHERE name = ? AND holder_id = ?`,
+		leaseName, nodeID,
+	).Error
+}
+
+// Leader returns the holder of the unexpired lease
+func (b *PostgresBackend) Leader() (string, error) {
+	var lease models.LeaderLease
+	res := b.db.Where("name = ? AND expires_at > now()", leaseName).Limit(1).Find(&lease)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return "", res.Error
+	}
+	return lease.HolderID, nil
+}
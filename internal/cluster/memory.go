@@ -0,0 +1,68 @@
+package cluster
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryBackend keeps leadership in process memory. Several electors can
+// share one backend to simulate a cluster in a single test; with a fake clock
+// and manual Campaign calls elections are fully deterministic.
+type MemoryBackend struct {
+	mu      sync.Mutex
+	holder  string
+	token   int64
+	expires time.Time
+	now     func() time.Time
+}
+
+var _ ElectionBackend = (*MemoryBackend)(nil)
+
+// NewMemoryBackend creates a backend that reads time from now; nil means time.Now
+func NewMemoryBackend(now func() time.Time) *MemoryBackend {
+	if now == nil {
+		now = time.Now
+	}
+	return &MemoryBackend{now: now}
+}
+
+func (b *MemoryBackend) Campaign(nodeID string, ttl time.Duration) (bool, int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if b.holder != nodeID && b.holder != "" && now.Before(b.expires) {
+		return false, 0, nil
+	}
+	if b.holder != nodeID {
+		b.holder = nodeID
+		b.token++
+	}
+	b.expires = now.Add(ttl)
+	return true, b.token, nil
+}
+
+func (b *MemoryBackend) Resign(nodeID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.holder == nodeID {
+		b.expires = b.now()
+	}
+	return nil
+}
+
+func (b *MemoryBackend) Leader() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.holder == "" || !b.now().Before(b.expires) {
+		return "", nil
+	}
+	return b.holder, nil
+}
+
+// Expire ends the current term as if the leader had crashed without resigning
+func (b *MemoryBackend) Expire() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expires = b.now()
+}
@@ -1,6 +1,10 @@
 package metrics
 
 import (
+	"regexp"
+	"sort"
+	"sync"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -21,6 +25,21 @@ var (
 		[]string{"status"},
 	)
 
+	TasksRejected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "task_rejected_total",
+			Help: "Total number of submitted tasks turned away because the queue was full",
+		},
+		[]string{"priority"},
+	)
+
+	TasksReclaimed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "task_reclaimed_total",
+			Help: "Total number of tasks requeued from dead nodes: running tasks whose node died or lease expired, and pending tasks held in a dead node's memory",
+		},
+	)
+
 	TasksInQueue = prometheus.NewGauge(
 		prometheus.GaugeOpts{
 			Name: "task_queue_length",
@@ -28,6 +47,20 @@ var (
 		},
 	)
 
+	TasksDelayed = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "task_delayed_length",
+			Help: "Number of tasks waiting for their scheduled run time",
+		},
+	)
+
+	DeadLetterQueueSize = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "task_dead_letter_queue_size",
+			Help: "Number of tasks in the dead-letter queue",
+		},
+	)
+
 	TaskDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "task_processing_seconds",
@@ -36,6 +69,24 @@ var (
 		},
 		[]string{"priority"},
 	)
+
+	TaskQueueWait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "task_queue_wait_seconds",
+			Help:    "Time tasks spent in the ready queue before a worker took them",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+		},
+		[]string{"priority"},
+	)
+
+	TaskEffectivePriority = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "task_effective_priority",
+			Help:    "Priority of tasks after aging when a worker took them (lower runs first; high is 100, low 900)",
+			Buckets: prometheus.LinearBuckets(0, 100, 11),
+		},
+		[]string{"priority"},
+	)
 )
 
 // Init registers all custom metrics
@@ -43,7 +94,99 @@ func Init() {
 	prometheus.MustRegister(
 		TasksSubmitted,
 		TasksProcessed,
+		TasksRejected,
+		TasksReclaimed,
 		TasksInQueue,
+		TasksDelayed,
+		DeadLetterQueueSize,
 		TaskDuration,
+		TaskQueueWait,
+		TaskEffectivePriority,
+	)
+}
+
+// tasksProcessedByLabel breaks task_processed_total down by the task labels
+// on the allowlist; it stays nil while the allowlist is empty
+var (
+	tasksProcessedByLabel *prometheus.CounterVec
+	taskLabelKeys         []string
+
+	// taskLabelValues holds the values exported so far per key, at most
+	// taskLabelMaxValues each
+	taskLabelValues    map[string]map[string]bool
+	taskLabelMaxValues int
+	taskLabelMutex     sync.Mutex
+)
+
+// otherLabelValue is exported in place of label values past a key's limit
+const otherLabelValue = "other"
+
+var invalidMetricLabel = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// EnableTaskLabels registers task_processed_by_label_total with one metric
+// label per allowlisted task label key. Keys are exported as label_<key> with
+// characters Prometheus doesn't allow replaced by underscores. Label values
+// come from clients, so only the first maxValues distinct values of each key
+// are exported as they are; later ones are counted as "other", which
+// keeps the number of series bounded.
+func EnableTaskLabels(keys []string, maxValues int) {
+	if len(keys) == 0 {
+		return
+	}
+	taskLabelMaxValues = maxValues
+	taskLabelValues = make(map[string]map[string]bool)
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+
+	// Keys that map to a name already taken, e.g. a.b after a_b, are dropped
+	names := []string{"status"}
+	taken := map[string]bool{}
+	for _, key := range sorted {
+		name := "label_" + invalidMetricLabel.ReplaceAllString(key, "_")
+		if taken[name] {
+			continue
+		}
+		taken[name] = true
+		taskLabelKeys = append(taskLabelKeys, key)
+		taskLabelValues[key] = make(map[string]bool)
+		names = append(names, name)
+	}
+	tasksProcessedByLabel = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "task_processed_by_label_total",
+			Help: "Total number of processed tasks by allowlisted task labels",
+		},
+		names,
 	)
+	prometheus.MustRegister(tasksProcessedByLabel)
+}
+
+// TaskProcessed counts a processed task with the given outcome
+func TaskProcessed(status string, labels map[string]string) {
+	TasksProcessed.WithLabelValues(status).Inc()
+	if tasksProcessedByLabel == nil {
+		return
+	}
+	values := []string{status}
+	for _, key := range taskLabelKeys {
+		values = append(values, boundedLabelValue(key, labels[key]))
+	}
+	tasksProcessedByLabel.WithLabelValues(values...).Inc()
+}
+
+// boundedLabelValue returns value if it is one of the values exported for key
+// or there is room for it, and otherLabelValue otherwise. A missing label is
+// exported as an empty value and takes no room.
+func boundedLabelValue(key, value string) string {
+	taskLabelMutex.Lock()
+	defer taskLabelMutex.Unlock()
+	seen := taskLabelValues[key]
+	if value == "" || seen[value] {
+		return value
+	}
+	if len(seen) >= taskLabelMaxValues {
+		return otherLabelValue
+	}
+	seen[value] = true
+	return value
 }
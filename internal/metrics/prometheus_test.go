@@ -0,0 +1,22 @@
+package metrics
+
+import "testing"
+
+func TestTaskLabelValuesBounded(t *testing.T) {
+	EnableTaskLabels([]string{"tenant"}, 2)
+
+	expect := []struct{ value, exported string }{
+		{"acme", "acme"},
+		{"globex", "globex"},
+		{"acme", "acme"},
+		{"initech", otherLabelValue},
+		{"", ""}, // no tenant label
+		{"globex", "globex"},
+	}
+	for _, e := range expect {
+		if got := boundedLabelValue("tenant", e.value); got != e.exported {
+			t.Fatalf("Expected %q to be exported as %q, got %q", e.value, e.exported, got)
+		}
+		TaskProcessed("completed", map[string]string{"tenant": e.value})
+	}
+}
@@ -3,6 +3,7 @@ package routes
 import (
 	"distributed-task-scheduler/internal/api"
 	"distributed-task-scheduler/internal/scheduler"
+	"distributed-task-scheduler/pkg/repositories"
 
 	_ "distributed-task-scheduler/docs"
 
@@ -13,14 +14,38 @@ import (
 )
 
 // RegisterRoutes sets up all routes on the given router.
-func RegisterRoutes(router *gin.Engine, s *scheduler.TaskScheduler) {
-	h := api.NewAPIHandler(s)
+func RegisterRoutes(router *gin.Engine, s *scheduler.TaskScheduler, nodes *repositories.NodeRepository) {
+	h := api.NewAPIHandler(s, nodes)
 
 	v1 := router.Group("/api/v1")
 	{
 		v1.POST("/tasks", h.SubmitTask)
+		v1.POST("/tasks/batch", h.SubmitTaskBatch)
 		v1.GET("/tasks/:id", h.GetTask)
-		v1.GET("/tasks", h.GetAllTasks)
+		v1.PATCH("/tasks/:id", h.UpdateTask)
+		v1.GET("/tasks", h.ListTasks)
+		v1.POST("/tasks/cancel", h.CancelTasks)
+		v1.DELETE("/tasks", h.DeleteTasks)
+		v1.POST("/tasks/bulk", h.StartOperation)
+		v1.GET("/operations/:id", h.GetOperation)
+		v1.GET("/tasks/:id/result", h.GetTaskResult)
+		v1.POST("/tasks/:id/cancel", h.CancelTask)
+
+		v1.GET("/dead-letters", h.ListDeadLetters)
+		v1.DELETE("/dead-letters", h.PurgeDeadLetters)
+		v1.GET("/dead-letters/:id", h.GetDeadLetter)
+		v1.DELETE("/dead-letters/:id", h.DeleteDeadLetter)
+		v1.POST("/dead-letters/:id/requeue", h.RequeueDeadLetter)
+
+		v1.POST("/workflows", h.SubmitWorkflow)
+		v1.GET("/workflows/:id", h.GetWorkflow)
+
+		v1.POST("/schedules", h.CreateSchedule)
+		v1.GET("/schedules", h.ListSchedules)
+		v1.GET("/schedules/:id", h.GetSchedule)
+		v1.DELETE("/schedules/:id", h.DeleteSchedule)
+
+		v1.GET("/cluster/nodes", h.ListNodes)
 	}
 
 	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
@@ -0,0 +1,55 @@
+package scheduler
+
+import (
+	"container/heap"
+	"time"
+)
+
+// agingLevel is how much a task's priority improves per aging step: the
+// distance between two named levels
+const agingLevel = Medium - High
+
+// SetAging makes tasks gain one priority level for every step they wait in
+// the ready heap, so that a steady stream of high priority tasks can't starve
+// low priority ones forever. A zero step, the default, orders strictly by
+// priority.
+//
+// Aging is continuous: a task's effective priority is its priority minus
+// agingLevel*wait/step. Comparing two tasks at any instant then comes down to
+// comparing readyAt + priority*step/agingLevel, which doesn't change as time
+// passes, so that is stored as the item's rank and the heap never needs to
+// be rebuilt.
+func (pq *PriorityQueue) SetAging(step time.Duration) {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	pq.agingStep = step
+	for _, item := range pq.items {
+		item.rank = pq.rank(item)
+	}
+	heap.Init(&pq.items)
+}
+
+// ready stamps an item entering the ready heap at the given time. Caller holds pq.lock.
+func (pq *PriorityQueue) ready(item *TaskQueueItem, at time.Time) {
+	item.readyAt = at
+	item.rank = pq.rank(item)
+}
+
+// rank is the heap key of an item under aging; the zero time without it. Caller holds pq.lock.
+func (pq *PriorityQueue) rank(item *TaskQueueItem) time.Time {
+	if pq.agingStep <= 0 {
+		return time.Time{}
+	}
+	return item.readyAt.Add(time.Duration(item.priority) * pq.agingStep / time.Duration(agingLevel))
+}
+
+// effectivePriority is an item's priority after aging; MinPriority is the
+// best it gets. Caller holds pq.lock.
+func (pq *PriorityQueue) effectivePriority(item *TaskQueueItem, now time.Time) float64 {
+	if pq.agingStep <= 0 {
+		return float64(item.priority)
+	}
+	aged := float64(item.priority) - float64(agingLevel)*float64(now.Sub(item.readyAt))/float64(pq.agingStep)
+	return max(aged, float64(MinPriority))
+}
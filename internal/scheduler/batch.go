@@ -0,0 +1,57 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+
+	"distributed-task-scheduler/pkg/models"
+)
+
+const defaultMaxBatchSize = 10000
+
+// SetMaxBatchSize limits how many tasks SubmitTasks accepts at once
+func (ts *TaskScheduler) SetMaxBatchSize(n int) {
+	ts.maxBatchSize = n
+}
+
+// MaxBatchSize returns how many tasks SubmitTasks accepts at once
+func (ts *TaskScheduler) MaxBatchSize() int {
+	return ts.maxBatchSize
+}
+
+// SubmitTasks stores many tasks in one transaction and then enqueues them.
+// The returned tasks are in the order of specs. Nothing is enqueued if the
+// batch can't be stored, and nothing is stored unless all of it fits in the
+// queue.
+func (ts *TaskScheduler) SubmitTasks(specs []TaskSpec) ([]*Task, error) {
+	if len(specs) > ts.maxBatchSize {
+		return nil, fmt.Errorf("%w: batch of %d tasks exceeds the limit of %d", ErrInvalid, len(specs), ts.maxBatchSize)
+	}
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	tasks := make([]*Task, len(specs))
+	rows := make([]*models.Task, len(specs))
+	for i, spec := range specs {
+		tasks[i] = spec.newTask()
+		rows[i] = ts.newRow(tasks[i])
+	}
+	if err := ts.admit(tasks...); err != nil {
+		return nil, err
+	}
+
+	if err := ts.repo.CreateBatch(rows); err != nil {
+		log.Printf("[Scheduler] DB insert of %d tasks failed: %v", len(rows), err)
+		return nil, err
+	}
+
+	created := make([]*Task, len(tasks))
+	for i, task := range tasks {
+		ts.remember(task)
+		created[i] = ts.snapshot(task)
+		ts.queue.PushTask(task)
+	}
+	log.Printf("[Scheduler] Submitted a batch of %d tasks", len(tasks))
+	return created, nil
+}
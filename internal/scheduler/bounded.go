@@ -0,0 +1,111 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"distributed-task-scheduler/internal/metrics"
+	"distributed-task-scheduler/pkg/models"
+)
+
+const defaultQueueRetryAfter = 5 * time.Second
+
+// QueueLimits bound how many tasks an in-memory queue holds, ready or
+// delayed. Zero or missing limits mean no limit.
+type QueueLimits struct {
+	Max int // across all priorities
+	// PerLevel limits the tasks of a priority level, see TaskPriority.Level;
+	// any priority of a level may be used as its key
+	PerLevel map[TaskPriority]int
+	// RetryAfter is what clients turned away are told to wait before trying again
+	RetryAfter time.Duration
+}
+
+// depthReporter is implemented by the queues that hold their tasks in memory
+type depthReporter interface {
+	// Depth returns how many tasks are queued, ready or delayed, in total and by priority level
+	Depth() (int, map[TaskPriority]int)
+}
+
+// levelCounts counts queued tasks by priority level
+type levelCounts map[TaskPriority]int
+
+func (c levelCounts) add(p TaskPriority, n int) {
+	c[p.Level()] += n
+}
+
+// SetQueueLimits bounds the queue. New submissions that would take it past
+// a limit fail with ErrQueueFull and nothing is stored; retried, recovered
+// and requeued tasks are always taken back. Limits only apply to in-memory
+// queues: a shared queue lives in the DB and isn't bounded by memory.
+// Submissions running at the same time may each see room for themselves, so
+// the queue can briefly go over by as many tasks as are being submitted.
+func (ts *TaskScheduler) SetQueueLimits(limits QueueLimits) {
+	if limits.RetryAfter <= 0 {
+		limits.RetryAfter = defaultQueueRetryAfter
+	}
+	// Keyed by level, keeping the tightest limit when several keys share one
+	perLevel := make(map[TaskPriority]int)
+	for p, limit := range limits.PerLevel {
+		if limit <= 0 {
+			continue
+		}
+		if current, ok := perLevel[p.Level()]; !ok || limit < current {
+			perLevel[p.Level()] = limit
+		}
+	}
+	limits.PerLevel = perLevel
+	ts.queueLimits = limits
+}
+
+// QueueRetryAfter returns how long clients should wait after ErrQueueFull
+func (ts *TaskScheduler) QueueRetryAfter() time.Duration {
+	if ts.queueLimits.RetryAfter <= 0 {
+		return defaultQueueRetryAfter
+	}
+	return ts.queueLimits.RetryAfter
+}
+
+// admit checks that the pending ones among tasks fit in the queue. Either all
+// of them fit or the whole submission is rejected and counted.
+func (ts *TaskScheduler) admit(tasks ...*Task) error {
+	limits := ts.queueLimits
+	if limits.Max <= 0 && len(limits.PerLevel) == 0 {
+		return nil
+	}
+	queue, ok := ts.queue.(depthReporter)
+	if !ok {
+		return nil
+	}
+
+	adding := make(levelCounts)
+	n := 0
+	for _, task := range tasks {
+		if task.Status == models.StatusPending {
+			adding.add(task.Priority, 1)
+			n++
+		}
+	}
+	total, byLevel := queue.Depth()
+
+	var err error
+	if limits.Max > 0 && total+n > limits.Max {
+		err = fmt.Errorf("%w: %d tasks queued, the limit is %d", ErrQueueFull, total, limits.Max)
+	}
+	for _, level := range []TaskPriority{High, Medium, Low} {
+		limit := limits.PerLevel[level]
+		if err == nil && limit > 0 && adding[level] > 0 && byLevel[level]+adding[level] > limit {
+			err = fmt.Errorf("%w: %d %s priority tasks queued, the limit is %d", ErrQueueFull, byLevel[level], level, limit)
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	for level, k := range adding {
+		metrics.TasksRejected.WithLabelValues(level.String()).Add(float64(k))
+	}
+	log.Printf("[Scheduler] Rejected %d tasks: %v", n, err)
+	return err
+}
@@ -0,0 +1,84 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"distributed-task-scheduler/pkg/models"
+)
+
+func TestQueueDepthByLevel(t *testing.T) {
+	fq, err := NewFairQueue(DefaultFairWeights, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []interface {
+		Queue
+		depthReporter
+	}{NewPriorityQueue(), fq} {
+		high := NewTask("echo", High, nil)
+		low := NewTask("echo", 850, nil)
+		later := time.Now().Add(time.Hour)
+		delayed := NewTask("echo", Low, nil)
+		delayed.RunAt = &later
+		q.PushTask(high)
+		q.PushTask(low)
+		q.PushTask(delayed)
+
+		total, byLevel := q.Depth()
+		if total != 3 || byLevel[High] != 1 || byLevel[Low] != 2 {
+			t.Fatalf("%T: expected 3 tasks, 1 high and 2 low, got %d and %v", q, total, byLevel)
+		}
+
+		q.Update(low.ID, func(task *Task) { task.Priority = 450 })
+		q.Remove(delayed.ID)
+		q.PopTask(context.Background())
+		total, byLevel = q.Depth()
+		if total != 1 || byLevel[High] != 0 || byLevel[Medium] != 1 || byLevel[Low] != 0 {
+			t.Fatalf("%T: expected 1 medium task, got %d and %v", q, total, byLevel)
+		}
+	}
+}
+
+func TestAdmitRejectsPastLimits(t *testing.T) {
+	q := NewPriorityQueue()
+	ts := NewTaskScheduler(q, nil)
+	ts.SetQueueLimits(QueueLimits{Max: 3, PerLevel: map[TaskPriority]int{Low: 1}})
+
+	q.PushTask(NewTask("echo", High, nil))
+	q.PushTask(NewTask("echo", Low, nil))
+
+	if err := ts.admit(NewTask("echo", Low, nil)); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Expected a low priority task to be rejected, got %v", err)
+	}
+	if err := ts.admit(NewTask("echo", High, nil), NewTask("echo", Medium, nil)); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Expected two tasks to go past the total limit, got %v", err)
+	}
+
+	// Blocked tasks of a workflow don't take up room until they are enqueued
+	blocked := NewTask("echo", Low, nil)
+	blocked.Status = models.StatusBlocked
+	if err := ts.admit(NewTask("echo", High, nil), blocked); err != nil {
+		t.Fatalf("Expected a high priority task to fit, got %v", err)
+	}
+	if got := ts.QueueRetryAfter(); got != defaultQueueRetryAfter {
+		t.Fatalf("Expected the default Retry-After, got %s", got)
+	}
+}
+
+func TestQueueLimitsKeyedByLevel(t *testing.T) {
+	q := NewPriorityQueue()
+	ts := NewTaskScheduler(q, nil)
+	// 850 is in the Low level
+	ts.SetQueueLimits(QueueLimits{PerLevel: map[TaskPriority]int{850: 1}})
+
+	q.PushTask(NewTask("echo", Low, nil))
+	if err := ts.admit(NewTask("echo", 950, nil)); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Expected the Low limit to apply, got %v", err)
+	}
+	if err := ts.admit(NewTask("echo", Medium, nil)); err != nil {
+		t.Fatalf("Expected a medium priority task to fit, got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"distributed-task-scheduler/pkg/models"
+	"distributed-task-scheduler/pkg/repositories"
+
+	"gorm.io/gorm"
+)
+
+// errTaskCancelled is the cancellation cause of a task's context and the
+// error recorded on cancelled tasks
+var errTaskCancelled = errors.New("task cancelled")
+
+// OnCancel registers fn to abort a task running on this node. Tasks running
+// on other nodes learn about the cancellation when they next renew their lease.
+func (ts *TaskScheduler) OnCancel(fn func(taskID string)) {
+	ts.onCancel = fn
+}
+
+// CancelTask stops a task. A pending or blocked task is taken off the queue and marked
+// cancelled right away; a running task is flagged and ends up cancelled once
+// the node running it has aborted its handler. Finished tasks give ErrConflict.
+func (ts *TaskScheduler) CancelTask(id string) (*Task, error) {
+	prev, err := ts.repo.CancelTask(id, errTaskCancelled.Error())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch prev {
+	case models.StatusPending, models.StatusBlocked:
+		ts.queue.Remove(id)
+		task, ok := ts.lookup(id)
+		if !ok {
+			return nil, ErrNotFound
+		}
+		finishedAt := time.Now().UTC()
+		ts.update(task, func(task *Task) {
+			task.Status = models.StatusCancelled
+			task.Error = errTaskCancelled.Error()
+			task.FinishedAt = &finishedAt
+		})
+		log.Printf("[Scheduler] Cancelled %s task %s", prev, id)
+		ts.TaskFinished(task)
+		return ts.snapshot(task), nil
+	case models.StatusRunning:
+		if ts.onCancel != nil {
+			ts.onCancel(id)
+		}
+		task, ok := ts.lookup(id)
+		if !ok {
+			return nil, ErrNotFound
+		}
+		ts.update(task, func(task *Task) { task.CancelRequested = true })
+		log.Printf("[Scheduler] Requested cancellation of running task %s", id)
+		return ts.snapshot(task), nil
+	default:
+		return nil, fmt.Errorf("%w: task %s is already %s", ErrConflict, id, prev)
+	}
+}
+
+// CancelTasks cancels every unfinished task matching the filter, like
+// CancelTask does for one. It returns how many tasks were cancelled right
+// away and how many running tasks were asked to stop.
+func (ts *TaskScheduler) CancelTasks(filter repositories.TaskFilter) (cancelled int, requested int, err error) {
+	stopped, running, err := ts.repo.CancelTasks(filter, errTaskCancelled.Error())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for i := range stopped {
+		ts.queue.Remove(stopped[i].ID)
+		task := taskFromModel(&stopped[i])
+		if cached, ok := ts.cached(task.ID); ok {
+			ts.update(cached, func(cached *Task) {
+				cached.Status = task.Status
+				cached.Error = task.Error
+				cached.FinishedAt = task.FinishedAt
+			})
+		}
+		ts.TaskFinished(task)
+	}
+	for i := range running {
+		if ts.onCancel != nil {
+			ts.onCancel(running[i].ID)
+		}
+		if cached, ok := ts.cached(running[i].ID); ok {
+			ts.update(cached, func(cached *Task) { cached.CancelRequested = true })
+		}
+	}
+
+	log.Printf("[Scheduler] Cancelled %d tasks and asked %d running tasks to stop", len(stopped), len(running))
+	return len(stopped), len(running), nil
+}
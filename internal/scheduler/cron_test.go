@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"distributed-task-scheduler/pkg/models"
+)
+
+func TestCronNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	cases := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, 1, 1, 10, 7, 30, 0, time.UTC), time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC), time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)},
+		{"30 9 * * mon-fri", time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC), time.Date(2024, 1, 8, 9, 30, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * 0", time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		// */2 starts with *, so both day fields must match: the next odd-numbered Monday
+		{"0 0 */2 * 1", time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, 6, 1, 12, 0, 0, 0, berlin), time.Date(2024, 6, 2, 1, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range cases {
+		cron, err := ParseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tc.expr, err)
+		}
+		if got := cron.Next(tc.from); !got.Equal(tc.want) {
+			t.Fatalf("%q after %s: expected %s, got %s", tc.expr, tc.from, tc.want, got)
+		}
+	}
+}
+
+func TestParseCronRejectsInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "* * * foo *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Fatalf("Expected %q to be rejected", expr)
+		}
+	}
+}
+
+func TestDueRunsCatchUp(t *testing.T) {
+	cron, _ := ParseCron("0 * * * *")
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2024, 1, 1, 3, 0, 30, 0, time.UTC) // 01:00 and 02:00 were missed, 03:00 is on time
+
+	fired := func(policy string) []int {
+		var hours []int
+		for _, run := range dueRuns(cron, from, now, time.Minute, policy) {
+			if run.fire {
+				hours = append(hours, run.at.Hour())
+			}
+		}
+		return hours
+	}
+
+	expect := map[string][]int{
+		models.CatchUpAll:  {1, 2, 3},
+		models.CatchUpLast: {2, 3},
+		models.CatchUpNone: {3},
+	}
+	for policy, want := range expect {
+		got := fired(policy)
+		if len(got) != len(want) {
+			t.Fatalf("Policy %s: expected runs at %v, got %v", policy, want, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("Policy %s: expected runs at %v, got %v", policy, want, got)
+			}
+		}
+	}
+
+	runs := dueRuns(cron, from, now, time.Minute, models.CatchUpNone)
+	if !runs[len(runs)-1].last {
+		t.Fatalf("Expected the final run to be marked last")
+	}
+}
+
+func TestDueRunsCatchUpLastAfterLongOutage(t *testing.T) {
+	cron, _ := ParseCron("* * * * *")
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := from.Add(24 * time.Hour) // 1440 runs, all but the last ones missed
+
+	runs := dueRuns(cron, from, now, time.Minute, models.CatchUpLast)
+	var fired []time.Time
+	for _, run := range runs {
+		if run.fire {
+			fired = append(fired, run.at)
+		}
+	}
+	latestMissed := now.Add(-2 * time.Minute)
+	if len(fired) == 0 || !fired[0].Equal(latestMissed) {
+		t.Fatalf("Expected the first firing to be the latest missed run %s, got %v", latestMissed, fired)
+	}
+	if len(fired) != 3 || !runs[len(runs)-1].last || !runs[len(runs)-1].at.Equal(now) {
+		t.Fatalf("Expected one catch-up run and the two on-time runs up to %s, got %v", now, fired)
+	}
+}
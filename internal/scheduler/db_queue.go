@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"distributed-task-scheduler/pkg/repositories"
+)
+
+// DBQueue is a queue shared by every node through the tasks table. Pending
+// rows are the queue: PopTask claims the most urgent due row with
+// SELECT ... FOR UPDATE SKIP LOCKED, so concurrent workers on any node never
+// claim the same task.
+type DBQueue struct {
+	repo         *repositories.TaskRepository
+	nodeID       string
+	pollInterval time.Duration
+	agingStep    time.Duration
+	wake         chan struct{}
+	closed       chan struct{}
+	closeOnce    sync.Once
+}
+
+var _ Queue = (*DBQueue)(nil)
+
+// NewDBQueue claims tasks for nodeID. Idle workers look for new rows every
+// pollInterval, or sooner when a task is pushed on this node.
+func NewDBQueue(repo *repositories.TaskRepository, nodeID string, pollInterval time.Duration) *DBQueue {
+	return &DBQueue{
+		repo:         repo,
+		nodeID:       nodeID,
+		pollInterval: pollInterval,
+		wake:         make(chan struct{}, 1),
+		closed:       make(chan struct{}),
+	}
+}
+
+// SetAging makes waiting tasks gain one priority level per step, like
+// PriorityQueue.SetAging does. A task waits from its run_at, or from its
+// creation without one. Zero, the default, claims strictly by priority.
+func (q *DBQueue) SetAging(step time.Duration) {
+	q.agingStep = step
+}
+
+// PushTask wakes an idle worker. The task row itself was already stored as
+// pending by whoever pushed it.
+func (q *DBQueue) PushTask(task *Task) {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// PopTask blocks until a due task could be claimed for this node
+func (q *DBQueue) PopTask(ctx context.Context) *Task {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-q.closed:
+			return nil
+		default:
+		}
+
+		dbTask, err := q.repo.ClaimNextTask(q.nodeID, taskLease, q.agingStep/time.Duration(agingLevel))
+		if err != nil {
+			log.Printf("[DBQueue] Failed to claim task: %v", err)
+		}
+		if dbTask != nil {
+			return taskFromModel(dbTask)
+		}
+
+		select {
+		case <-q.wake:
+		case <-time.After(q.pollInterval):
+		case <-ctx.Done():
+			return nil
+		case <-q.closed:
+			return nil
+		}
+	}
+}
+
+// Len returns the number of due pending tasks across the cluster
+func (q *DBQueue) Len() int {
+	n, err := q.repo.CountDueTasks()
+	if err != nil {
+		log.Printf("[DBQueue] Failed to count tasks: %v", err)
+	}
+	return int(n)
+}
+
+// Remove has nothing to do: a task leaves this queue as soon as its row is
+// no longer pending
+func (q *DBQueue) Remove(taskID string) bool { return false }
+
+// Update has nothing to do either: changes to the row are what this queue sees
+func (q *DBQueue) Update(taskID string, fn func(task *Task)) bool { return false }
+
+// Shared is true: other nodes consume the same rows
+func (q *DBQueue) Shared() bool { return true }
+
+// Close stops this node's workers from claiming more rows; the rows stay for other nodes
+func (q *DBQueue) Close() {
+	q.closeOnce.Do(func() { close(q.closed) })
+}
@@ -0,0 +1,88 @@
+package scheduler
+
+import (
+	"errors"
+	"log"
+
+	"distributed-task-scheduler/internal/metrics"
+	"distributed-task-scheduler/pkg/models"
+
+	"gorm.io/gorm"
+)
+
+// ListDeadLetters returns every dead-lettered task, newest first
+func (ts *TaskScheduler) ListDeadLetters() ([]models.DeadLetter, error) {
+	entries, err := ts.repo.ListDeadLetters()
+	for i := range entries {
+		entries[i].Payload = decodeJSON(entries[i].Payload)
+	}
+	return entries, err
+}
+
+// GetDeadLetter returns a single dead-letter entry
+func (ts *TaskScheduler) GetDeadLetter(id string) (*models.DeadLetter, error) {
+	entry, err := ts.repo.GetDeadLetter(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry.Payload = decodeJSON(entry.Payload)
+	return entry, nil
+}
+
+// RequeueDeadLetter resets the task's attempts and puts it back on the queue
+func (ts *TaskScheduler) RequeueDeadLetter(id string) (*Task, error) {
+	dbTask, err := ts.repo.RequeueDeadLetter(id, ts.holder())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	ts.refreshDeadLetterGauge()
+
+	task := taskFromModel(dbTask)
+	ts.remember(task)
+	requeued := ts.snapshot(task)
+	ts.queue.PushTask(task)
+
+	log.Printf("[Scheduler] Requeued dead-lettered task %s", requeued.ID)
+	return requeued, nil
+}
+
+// DeleteDeadLetter drops one entry without requeueing its task
+func (ts *TaskScheduler) DeleteDeadLetter(id string) error {
+	found, err := ts.repo.DeleteDeadLetter(id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrNotFound
+	}
+	ts.refreshDeadLetterGauge()
+	return nil
+}
+
+// PurgeDeadLetters drops every entry and returns how many were removed
+func (ts *TaskScheduler) PurgeDeadLetters() (int64, error) {
+	n, err := ts.repo.PurgeDeadLetters()
+	if err != nil {
+		return n, err
+	}
+	ts.refreshDeadLetterGauge()
+	return n, nil
+}
+
+// refreshDeadLetterGauge sets the DLQ size metric from the database. Every
+// node sets it from the same count, so the metric agrees across the cluster
+// no matter which node dead-lettered or requeued a task.
+func (ts *TaskScheduler) refreshDeadLetterGauge() {
+	count, err := ts.repo.CountDeadLetters()
+	if err != nil {
+		log.Printf("[Scheduler] Failed to count dead letters: %v", err)
+		return
+	}
+	metrics.DeadLetterQueueSize.Set(float64(count))
+}
@@ -0,0 +1,88 @@
+package scheduler
+
+import (
+	"container/heap"
+	"time"
+
+	"distributed-task-scheduler/internal/metrics"
+)
+
+// delayHeap orders tasks that aren't due yet by their run time; like taskHeap
+// it is only touched with PriorityQueue.lock held
+type delayHeap []*TaskQueueItem
+
+func (h delayHeap) Len() int { return len(h) }
+
+func (h delayHeap) Less(i, j int) bool {
+	return h[i].runAt.Before(h[j].runAt)
+}
+
+func (h delayHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *delayHeap) Push(x interface{}) {
+	item := x.(*TaskQueueItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *delayHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*h = old[:n-1]
+	return item
+}
+
+// Delayed returns the number of tasks waiting for their run time
+func (pq *PriorityQueue) Delayed() int {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+	return len(pq.delayed)
+}
+
+// pushDelayed parks an item until its run time. Caller holds pq.lock.
+func (pq *PriorityQueue) pushDelayed(item *TaskQueueItem) {
+	heap.Push(&pq.delayed, item)
+	metrics.TasksDelayed.Inc()
+	pq.armTimer()
+}
+
+// armTimer makes sure the release timer fires when the earliest delayed item
+// is due. Caller holds pq.lock.
+func (pq *PriorityQueue) armTimer() {
+	if len(pq.delayed) == 0 {
+		if pq.timer != nil {
+			pq.timer.Stop()
+		}
+		return
+	}
+	wait := time.Until(pq.delayed[0].runAt)
+	if pq.timer == nil {
+		pq.timer = time.AfterFunc(wait, pq.releaseDue)
+		return
+	}
+	pq.timer.Reset(wait)
+}
+
+// releaseDue moves every delayed item whose run time has passed into the priority heap
+func (pq *PriorityQueue) releaseDue() {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	now := time.Now()
+	for len(pq.delayed) > 0 && !pq.delayed[0].runAt.After(now) {
+		item := heap.Pop(&pq.delayed).(*TaskQueueItem)
+		metrics.TasksDelayed.Dec()
+		pq.ready(item, item.runAt)
+		heap.Push(&pq.items, item)
+		metrics.TasksInQueue.Inc()
+		pq.cond.Signal()
+	}
+	pq.armTimer()
+}
@@ -0,0 +1,402 @@
+package scheduler
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"distributed-task-scheduler/internal/metrics"
+)
+
+// DefaultFairWeights are the shares of worker capacity High, Medium and Low
+// tasks get from a FairQueue when all of them are waiting
+var DefaultFairWeights = map[TaskPriority]int{High: 70, Medium: 20, Low: 10}
+
+// FairQueue hands out tasks by weighted shares instead of strict priority.
+// Tasks are grouped by priority level (see TaskPriority.Level). Each level
+// gets its weight's share of the pops while it has tasks waiting, using
+// deficit round robin. Shares of idle levels go to the busy ones.
+//
+// Within a level, tasks can further be split by tenant, named by a task
+// label. Tenants take turns by their own weights. Tasks of one tenant and
+// level run in the order they were pushed.
+type FairQueue struct {
+	tenantLabel   string // empty puts every task in the same tenant
+	tenantWeights map[string]int
+
+	priorities *drr[TaskPriority]
+	classes    map[TaskPriority]*fairClass
+	byID       map[string]*fairItem
+	depth      levelCounts // byID counted by priority level
+	ready      int
+	delayed    int
+	closed     bool
+	lock       sync.Mutex
+	cond       *sync.Cond
+}
+
+var _ Queue = (*FairQueue)(nil)
+
+// fairClass holds the ready tasks of one priority, in one FIFO per tenant
+type fairClass struct {
+	tenants *drr[string]
+	fifos   map[string]*list.List
+	len     int
+}
+
+// fairItem is a task in a FairQueue; elem is nil while the task is delayed
+type fairItem struct {
+	task    *Task
+	class   TaskPriority // the class the task is queued in
+	tenant  string
+	elem    *list.Element
+	timer   *time.Timer
+	readyAt time.Time
+}
+
+// NewFairQueue creates a queue sharing capacity between priorities by
+// weights. With a tenantLabel, tasks of each priority are also shared out
+// between the values of that label by tenantWeights; unlisted tenants weigh 1.
+func NewFairQueue(weights map[TaskPriority]int, tenantLabel string, tenantWeights map[string]int) (*FairQueue, error) {
+	for _, p := range []TaskPriority{High, Medium, Low} {
+		if weights[p] <= 0 {
+			return nil, fmt.Errorf("the %s priority needs a positive weight", p)
+		}
+	}
+	for tenant, w := range tenantWeights {
+		if w <= 0 {
+			return nil, fmt.Errorf("tenant %q needs a positive weight", tenant)
+		}
+	}
+
+	quanta := normalizeWeights(weights)
+	fq := &FairQueue{
+		tenantLabel:   tenantLabel,
+		tenantWeights: tenantWeights,
+		priorities:    newDRR(func(p TaskPriority) int { return quanta[p] }),
+		classes:       make(map[TaskPriority]*fairClass),
+		byID:          make(map[string]*fairItem),
+		depth:         make(levelCounts),
+	}
+	for _, p := range []TaskPriority{High, Medium, Low} {
+		fq.priorities.add(p)
+		fq.classes[p] = &fairClass{
+			tenants: newDRR(fq.tenantWeight),
+			fifos:   make(map[string]*list.List),
+		}
+	}
+	// Start the first round with High
+	fq.priorities.cur = len(fq.priorities.keys) - 1
+	fq.cond = sync.NewCond(&fq.lock)
+	return fq, nil
+}
+
+// ParseWeights reads weights written as "70,20,10" (High, Medium, Low) or,
+// with names, as "high=70,medium=20,low=10"
+func ParseWeights(s string) (map[TaskPriority]int, error) {
+	weights := make(map[TaskPriority]int)
+	if named, err := ParseNamedWeights(s); err == nil {
+	names:
+		for name, w := range named {
+			for _, p := range []TaskPriority{High, Medium, Low} {
+				if p.String() == name {
+					weights[p] = w
+					continue names
+				}
+			}
+			return nil, fmt.Errorf("unknown priority %q", name)
+		}
+		return weights, nil
+	}
+
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("expected three weights for high, medium and low, got %q", s)
+	}
+	for i, part := range parts {
+		w, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight %q", part)
+		}
+		weights[[]TaskPriority{High, Medium, Low}[i]] = w
+	}
+	return weights, nil
+}
+
+// ParseNamedWeights reads weights written as "name=weight,..."
+func ParseNamedWeights(s string) (map[string]int, error) {
+	weights := make(map[string]int)
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected name=weight, got %q", part)
+		}
+		w, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight %q", value)
+		}
+		weights[strings.TrimSpace(name)] = w
+	}
+	return weights, nil
+}
+
+func (fq *FairQueue) PushTask(task *Task) {
+	fq.lock.Lock()
+	defer fq.lock.Unlock()
+
+	item := &fairItem{
+		task:   task,
+		class:  fq.classOf(task.Priority),
+		tenant: task.Labels[fq.tenantLabel],
+	}
+	fq.byID[task.ID] = item
+	fq.depth.add(item.class, 1)
+	if task.RunAt != nil && task.RunAt.After(time.Now()) {
+		fq.delayed++
+		metrics.TasksDelayed.Inc()
+		item.timer = time.AfterFunc(time.Until(*task.RunAt), func() { fq.release(item) })
+		return
+	}
+	fq.enqueue(item, time.Now())
+}
+
+func (fq *FairQueue) PopTask(ctx context.Context) *Task {
+	fq.lock.Lock()
+	defer fq.lock.Unlock()
+
+	if !waitReady(ctx, fq.cond, func() bool { return fq.ready > 0 }, func() bool { return fq.closed }) {
+		return nil
+	}
+
+	p := fq.priorities.pick(func(p TaskPriority) bool { return fq.classes[p].len > 0 })
+	class := fq.classes[p]
+	tenant := class.tenants.pick(func(string) bool { return true })
+	item := fq.dequeue(class, tenant, class.fifos[tenant].Front())
+	delete(fq.byID, item.task.ID)
+	fq.depth.add(item.class, -1)
+
+	level := item.task.Priority.Level().String()
+	metrics.TaskQueueWait.WithLabelValues(level).Observe(time.Since(item.readyAt).Seconds())
+	metrics.TaskEffectivePriority.WithLabelValues(level).Observe(float64(item.task.Priority))
+	return item.task
+}
+
+// Len returns the number of tasks that are due
+func (fq *FairQueue) Len() int {
+	fq.lock.Lock()
+	defer fq.lock.Unlock()
+	return fq.ready
+}
+
+// Delayed returns the number of tasks waiting for their run time
+func (fq *FairQueue) Delayed() int {
+	fq.lock.Lock()
+	defer fq.lock.Unlock()
+	return fq.delayed
+}
+
+func (fq *FairQueue) Remove(taskID string) bool {
+	fq.lock.Lock()
+	defer fq.lock.Unlock()
+
+	item, ok := fq.byID[taskID]
+	if !ok {
+		return false
+	}
+	delete(fq.byID, taskID)
+	fq.depth.add(item.class, -1)
+	if item.elem == nil {
+		item.timer.Stop()
+		fq.delayed--
+		metrics.TasksDelayed.Dec()
+		return true
+	}
+	fq.dequeue(fq.classes[item.class], item.tenant, item.elem)
+	return true
+}
+
+// Update changes a queued task. A ready task whose priority changed moves to
+// the back of its new priority's line.
+func (fq *FairQueue) Update(taskID string, fn func(task *Task)) bool {
+	fq.lock.Lock()
+	defer fq.lock.Unlock()
+
+	item, ok := fq.byID[taskID]
+	if !ok {
+		return false
+	}
+	fn(item.task)
+	class := fq.classOf(item.task.Priority)
+	if class == item.class {
+		return true
+	}
+	fq.depth.add(item.class, -1)
+	fq.depth.add(class, 1)
+	if item.elem == nil {
+		item.class = class
+		return true
+	}
+	readyAt := item.readyAt
+	fq.dequeue(fq.classes[item.class], item.tenant, item.elem)
+	item.class = class
+	fq.enqueue(item, readyAt)
+	return true
+}
+
+// Shared is false: the queue only lives in this process
+func (fq *FairQueue) Shared() bool { return false }
+
+func (fq *FairQueue) Close() {
+	fq.lock.Lock()
+	defer fq.lock.Unlock()
+	fq.closed = true
+	fq.cond.Broadcast()
+}
+
+// Depth returns how many tasks are queued, ready or delayed, in total and by priority level
+func (fq *FairQueue) Depth() (int, map[TaskPriority]int) {
+	fq.lock.Lock()
+	defer fq.lock.Unlock()
+	return len(fq.byID), maps.Clone(fq.depth)
+}
+
+// release moves a delayed task to the ready queue once it is due
+func (fq *FairQueue) release(item *fairItem) {
+	fq.lock.Lock()
+	defer fq.lock.Unlock()
+
+	// The task may have been removed while the timer was firing
+	if fq.byID[item.task.ID] != item || item.elem != nil {
+		return
+	}
+	fq.delayed--
+	metrics.TasksDelayed.Dec()
+	fq.enqueue(item, time.Now())
+}
+
+// enqueue appends a ready item to its tenant's line. Caller holds fq.lock.
+func (fq *FairQueue) enqueue(item *fairItem, readyAt time.Time) {
+	class := fq.classes[item.class]
+	fifo, ok := class.fifos[item.tenant]
+	if !ok {
+		fifo = list.New()
+		class.fifos[item.tenant] = fifo
+		class.tenants.add(item.tenant)
+	}
+	item.readyAt = readyAt
+	item.elem = fifo.PushBack(item)
+	class.len++
+	fq.ready++
+	metrics.TasksInQueue.Inc()
+	fq.cond.Signal()
+}
+
+// dequeue takes a ready item out of its tenant's line. Caller holds fq.lock.
+func (fq *FairQueue) dequeue(class *fairClass, tenant string, elem *list.Element) *fairItem {
+	fifo := class.fifos[tenant]
+	item := fifo.Remove(elem).(*fairItem)
+	item.elem = nil
+	if fifo.Len() == 0 {
+		delete(class.fifos, tenant)
+		class.tenants.remove(tenant)
+	}
+	class.len--
+	fq.ready--
+	metrics.TasksInQueue.Dec()
+	return item
+}
+
+// classOf returns the class a priority is queued in: its level
+func (fq *FairQueue) classOf(p TaskPriority) TaskPriority {
+	return p.Level()
+}
+
+func (fq *FairQueue) tenantWeight(tenant string) int {
+	if w, ok := fq.tenantWeights[tenant]; ok {
+		return w
+	}
+	return 1
+}
+
+// normalizeWeights divides weights by their greatest common divisor, so that
+// 70/20/10 hands out turns of 7, 2 and 1 rather than long bursts
+func normalizeWeights[K comparable](weights map[K]int) map[K]int {
+	d := 0
+	for _, w := range weights {
+		d = gcd(d, w)
+	}
+	normalized := make(map[K]int, len(weights))
+	for k, w := range weights {
+		normalized[k] = w / max(d, 1)
+	}
+	return normalized
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// drr is a deficit round robin over keys: each turn a key may be served as
+// many times as its weight, so over time every busy key gets its share
+type drr[K comparable] struct {
+	keys    []K
+	cur     int
+	deficit map[K]int
+	weight  func(K) int
+}
+
+func newDRR[K comparable](weight func(K) int) *drr[K] {
+	return &drr[K]{deficit: make(map[K]int), weight: weight}
+}
+
+// add puts a key at the end of the round
+func (d *drr[K]) add(k K) {
+	d.keys = append(d.keys, k)
+}
+
+// remove drops a key from the round along with its deficit
+func (d *drr[K]) remove(k K) {
+	for i, key := range d.keys {
+		if key != k {
+			continue
+		}
+		d.keys = append(d.keys[:i], d.keys[i+1:]...)
+		// Step back so that the key after k gets a full turn next
+		if i <= d.cur {
+			d.cur--
+		}
+		if d.cur < 0 {
+			d.cur = max(len(d.keys)-1, 0)
+		}
+		delete(d.deficit, k)
+		return
+	}
+}
+
+// pick returns the key to serve next. At least one key must be busy.
+func (d *drr[K]) pick(busy func(K) bool) K {
+	for {
+		k := d.keys[d.cur]
+		if busy(k) && d.deficit[k] > 0 {
+			d.deficit[k]--
+			return k
+		}
+		// An idle key doesn't save up turns
+		d.deficit[k] = 0
+		d.cur = (d.cur + 1) % len(d.keys)
+		if next := d.keys[d.cur]; busy(next) {
+			d.deficit[next] += d.weight(next)
+		}
+	}
+}
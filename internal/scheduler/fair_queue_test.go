@@ -0,0 +1,160 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestFairQueue(t *testing.T, tenantLabel string, tenantWeights map[string]int) *FairQueue {
+	t.Helper()
+	q, err := NewFairQueue(DefaultFairWeights, tenantLabel, tenantWeights)
+	if err != nil {
+		t.Fatalf("NewFairQueue failed: %v", err)
+	}
+	return q
+}
+
+func TestFairQueueSharesUnderSaturation(t *testing.T) {
+	q := newTestFairQueue(t, "", nil)
+	for i := 0; i < 1000; i++ {
+		for _, p := range []TaskPriority{High, Medium, Low} {
+			q.PushTask(NewTask("echo", p, nil))
+		}
+	}
+
+	counts := map[TaskPriority]int{}
+	for i := 0; i < 1000; i++ {
+		counts[q.PopTask(context.Background()).Priority]++
+	}
+	if counts[High] != 700 || counts[Medium] != 200 || counts[Low] != 100 {
+		t.Fatalf("Expected a 700/200/100 split, got %d/%d/%d", counts[High], counts[Medium], counts[Low])
+	}
+}
+
+func TestFairQueueSharesWithConcurrentWorkers(t *testing.T) {
+	q := newTestFairQueue(t, "", nil)
+	for i := 0; i < 3000; i++ {
+		for _, p := range []TaskPriority{High, Medium, Low} {
+			q.PushTask(NewTask("echo", p, nil))
+		}
+	}
+
+	// Workers pop while producers keep every priority saturated
+	var mu sync.Mutex
+	counts := map[TaskPriority]int{}
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				task := q.PopTask(context.Background())
+				mu.Lock()
+				counts[task.Priority]++
+				mu.Unlock()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				for _, p := range []TaskPriority{High, Medium, Low} {
+					q.PushTask(NewTask("echo", p, nil))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	total := counts[High] + counts[Medium] + counts[Low]
+	for p, want := range map[TaskPriority]float64{High: 0.7, Medium: 0.2, Low: 0.1} {
+		if got := float64(counts[p]) / float64(total); got < want-0.01 || got > want+0.01 {
+			t.Errorf("Expected %s tasks to get %.0f%% of the pops, got %.1f%%", p, want*100, got*100)
+		}
+	}
+}
+
+func TestFairQueueIdleSharesGoToBusyPriorities(t *testing.T) {
+	q := newTestFairQueue(t, "", nil)
+	for i := 0; i < 10; i++ {
+		q.PushTask(NewTask("echo", Low, nil))
+	}
+	for i := 0; i < 10; i++ {
+		if got := q.PopTask(context.Background()); got.Priority != Low {
+			t.Fatalf("Expected only low priority tasks, got %s", got.Priority)
+		}
+	}
+}
+
+func TestFairQueueTenantShares(t *testing.T) {
+	q := newTestFairQueue(t, "tenant", map[string]int{"big": 3})
+	push := func(tenant string, n int) {
+		for i := 0; i < n; i++ {
+			task := NewTask("echo", High, nil)
+			task.Labels = map[string]string{"tenant": tenant}
+			q.PushTask(task)
+		}
+	}
+	push("noisy", 900)
+	push("big", 300)
+	push("small", 300)
+
+	// noisy and small weigh 1, big weighs 3
+	counts := map[string]int{}
+	for i := 0; i < 500; i++ {
+		counts[q.PopTask(context.Background()).Labels["tenant"]]++
+	}
+	if counts["noisy"] != 100 || counts["small"] != 100 || counts["big"] != 300 {
+		t.Fatalf("Expected a 100/300/100 split, got noisy %d, big %d, small %d", counts["noisy"], counts["big"], counts["small"])
+	}
+}
+
+func TestFairQueueRemoveUpdateAndDelay(t *testing.T) {
+	q := newTestFairQueue(t, "", nil)
+
+	runAt := time.Now().Add(100 * time.Millisecond)
+	delayed := NewTask("echo", High, nil)
+	delayed.RunAt = &runAt
+	removed := NewTask("echo", High, nil)
+	promoted := NewTask("echo", Low, nil)
+	for _, task := range []*Task{delayed, removed, promoted} {
+		q.PushTask(task)
+	}
+	if q.Len() != 2 || q.Delayed() != 1 {
+		t.Fatalf("Expected 2 ready and 1 delayed task, got %d and %d", q.Len(), q.Delayed())
+	}
+
+	if !q.Remove(removed.ID) || q.Remove(removed.ID) {
+		t.Fatal("Expected the task to be removed exactly once")
+	}
+	if !q.Update(promoted.ID, func(task *Task) { task.Priority = High }) {
+		t.Fatal("Expected the queued task to be updated")
+	}
+	if got := q.PopTask(context.Background()); got.ID != promoted.ID {
+		t.Fatalf("Expected the promoted task, got %s", got.ID)
+	}
+	if got := q.PopTask(context.Background()); got.ID != delayed.ID || time.Now().Before(runAt) {
+		t.Fatalf("Expected the delayed task once due, got %s", got.ID)
+	}
+}
+
+func TestParseWeights(t *testing.T) {
+	for _, s := range []string{"70,20,10", "high=70,medium=20,low=10", " 70, 20 ,10 "} {
+		weights, err := ParseWeights(s)
+		if err != nil {
+			t.Fatalf("ParseWeights(%q) failed: %v", s, err)
+		}
+		if weights[High] != 70 || weights[Medium] != 20 || weights[Low] != 10 {
+			t.Fatalf("ParseWeights(%q) = %v", s, weights)
+		}
+	}
+	for _, s := range []string{"70,20", "urgent=5", "a,b,c"} {
+		if _, err := ParseWeights(s); err == nil {
+			t.Errorf("Expected ParseWeights(%q) to fail", s)
+		}
+	}
+	if _, err := NewFairQueue(map[TaskPriority]int{High: 1, Medium: 0, Low: 1}, "", nil); err == nil {
+		t.Error("Expected a zero weight to be rejected")
+	}
+}
@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+const defaultIdempotencyWindow = 24 * time.Hour
+
+// SetIdempotencyWindow sets how long a repeated idempotency key returns the
+// task it first created; after that the key may be reused
+func (ts *TaskScheduler) SetIdempotencyWindow(window time.Duration) {
+	ts.idempotencyWindow = window
+}
+
+// SubmitTaskWithKey submits a task at most once per idempotency key.
+// requestHash fingerprints the request; repeating a key with the same
+// fingerprint returns the original task and false, while a different
+// fingerprint gives ErrConflict. While the queue is full, repeats get
+// ErrQueueFull like new keys do; retrying later returns the original task.
+func (ts *TaskScheduler) SubmitTaskWithKey(spec TaskSpec, key string, requestHash string) (*Task, bool, error) {
+	task := spec.newTask()
+	if err := ts.admit(task); err != nil {
+		return nil, false, err
+	}
+
+	existing, err := ts.repo.CreateTaskWithKey(ts.newRow(task), key, requestHash, ts.idempotencyWindow)
+	if err != nil {
+		log.Printf("[Scheduler] DB insert failed: %v", err)
+		return nil, false, err
+	}
+	if existing != nil {
+		if existing.RequestHash != requestHash {
+			return nil, false, fmt.Errorf("%w: idempotency key %q was already used for a different request", ErrConflict, key)
+		}
+		original, ok := ts.GetTask(existing.TaskID)
+		if !ok {
+			return nil, false, fmt.Errorf("task %s of idempotency key %q is gone", existing.TaskID, key)
+		}
+		log.Printf("[Scheduler] Idempotency key %q repeated, returning task %s", key, original.ID)
+		return original, false, nil
+	}
+
+	ts.remember(task)
+	created := ts.snapshot(task)
+	ts.queue.PushTask(task)
+	log.Printf("[Scheduler] Submitted %s task %s with %s priority under idempotency key %q", created.Type, created.ID, created.Priority.String(), key)
+	return created, true, nil
+}
@@ -0,0 +1,153 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"distributed-task-scheduler/pkg/models"
+	"distributed-task-scheduler/pkg/repositories"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// operationBatchSize is how many tasks a bulk operation handles per transaction
+const operationBatchSize = 500
+
+// OperationSpec describes an action to apply to every task matching a filter
+type OperationSpec struct {
+	Action   string // one of the models.Action* constants
+	Filter   repositories.TaskFilter
+	Priority *TaskPriority // new priority, for set_priority only
+}
+
+// SetNodeID names this node on the operations it runs
+func (ts *TaskScheduler) SetNodeID(nodeID string) {
+	ts.nodeID = nodeID
+}
+
+// StartOperation records a bulk operation and runs it in the background. The
+// tasks matching the filter at this point are worked through in batches;
+// each batch re-checks the filter, so tasks that changed in the meantime are
+// skipped rather than overwritten. Poll GetOperation for progress.
+func (ts *TaskScheduler) StartOperation(spec OperationSpec) (*models.Operation, error) {
+	switch spec.Action {
+	case models.ActionCancel, models.ActionRequeue, models.ActionDelete:
+		if spec.Priority != nil {
+			return nil, fmt.Errorf("%w: priority only applies to %s", ErrInvalid, models.ActionSetPriority)
+		}
+	case models.ActionSetPriority:
+		if spec.Priority == nil {
+			return nil, fmt.Errorf("%w: %s needs a priority", ErrInvalid, models.ActionSetPriority)
+		}
+	default:
+		return nil, fmt.Errorf("%w: action must be one of cancel, requeue, set_priority, delete", ErrInvalid)
+	}
+	if spec.Filter.IsEmpty() {
+		return nil, fmt.Errorf("%w: a filter or selector is required", ErrInvalid)
+	}
+
+	ids, err := ts.repo.MatchingTaskIDs(spec.Filter)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := json.Marshal(spec.Filter)
+	if err != nil {
+		return nil, err
+	}
+	op := &models.Operation{
+		ID:        uuid.New().String(),
+		Action:    spec.Action,
+		Filter:    filter,
+		Status:    models.OperationRunning,
+		Matched:   len(ids),
+		NodeID:    ts.nodeID,
+		CreatedAt: time.Now().UTC(),
+	}
+	if spec.Priority != nil {
+		priority := models.TaskPriority(*spec.Priority)
+		op.Priority = &priority
+	}
+	if err := ts.repo.CreateOperation(op); err != nil {
+		return nil, err
+	}
+	log.Printf("[Scheduler] Started %s operation %s on %d tasks", op.Action, op.ID, len(ids))
+
+	go ts.runOperation(op.ID, spec, ids)
+	return op, nil
+}
+
+func (ts *TaskScheduler) GetOperation(id string) (*models.Operation, error) {
+	op, err := ts.repo.GetOperation(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	return op, err
+}
+
+// runOperation applies an operation to ids one batch at a time, recording
+// progress after each batch. The first failing batch fails the operation.
+func (ts *TaskScheduler) runOperation(id string, spec OperationSpec, ids []string) {
+	processed, affected := 0, 0
+	for start := 0; start < len(ids); start += operationBatchSize {
+		batch := ids[start:min(start+operationBatchSize, len(ids))]
+		filter := spec.Filter
+		filter.IDs = batch
+
+		n, err := ts.applyOperation(spec, filter)
+		if err != nil {
+			log.Printf("[Scheduler] Operation %s failed after %d of %d tasks: %v", id, processed, len(ids), err)
+			if err := ts.repo.FinishOperation(id, models.OperationFailed, err.Error()); err != nil {
+				log.Printf("[Scheduler] Failed to record the end of operation %s: %v", id, err)
+			}
+			return
+		}
+		processed += len(batch)
+		affected += n
+		if err := ts.repo.UpdateOperationProgress(id, processed, affected); err != nil {
+			log.Printf("[Scheduler] Failed to record progress of operation %s: %v", id, err)
+		}
+	}
+
+	if err := ts.repo.FinishOperation(id, models.OperationCompleted, ""); err != nil {
+		log.Printf("[Scheduler] Failed to record the end of operation %s: %v", id, err)
+	}
+	log.Printf("[Scheduler] Operation %s (%s) done: %d of %d tasks affected", id, spec.Action, affected, len(ids))
+}
+
+// applyOperation runs the action on one batch and returns how many tasks it applied to
+func (ts *TaskScheduler) applyOperation(spec OperationSpec, filter repositories.TaskFilter) (int, error) {
+	switch spec.Action {
+	case models.ActionCancel:
+		cancelled, requested, err := ts.CancelTasks(filter)
+		return cancelled + requested, err
+	case models.ActionRequeue:
+		return ts.requeueTasks(filter)
+	case models.ActionSetPriority:
+		return ts.setPriority(filter, *spec.Priority)
+	case models.ActionDelete:
+		return ts.DeleteTasks(filter)
+	}
+	return 0, fmt.Errorf("unknown action %q", spec.Action)
+}
+
+// requeueTasks resets failed and timed-out tasks and puts them back on the queue
+func (ts *TaskScheduler) requeueTasks(filter repositories.TaskFilter) (int, error) {
+	rows, dropped, err := ts.repo.RequeueTasks(filter, ts.holder())
+	if err != nil {
+		return 0, err
+	}
+	if dropped > 0 {
+		ts.refreshDeadLetterGauge()
+	}
+
+	for i := range rows {
+		task := taskFromModel(&rows[i])
+		ts.remember(task)
+		ts.queue.PushTask(task)
+	}
+	return len(rows), nil
+}
@@ -0,0 +1,66 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"distributed-task-scheduler/pkg/models"
+	"distributed-task-scheduler/pkg/repositories"
+)
+
+// SetPriority changes the priority of a pending or blocked task. A task that
+// is still queued on this node is moved to its new place in the queue.
+func (ts *TaskScheduler) SetPriority(id string, priority TaskPriority) (*Task, error) {
+	changed, err := ts.setPriority(repositories.TaskFilter{IDs: []string{id}}, priority)
+	if err != nil {
+		return nil, err
+	}
+
+	task, ok := ts.GetTask(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if changed == 0 && task.Priority != priority {
+		return nil, fmt.Errorf("%w: task is %s", ErrConflict, task.Status)
+	}
+	return task, nil
+}
+
+// setPriority changes the priority of the pending and blocked tasks matching
+// the filter and returns how many changed. The change is recorded in each
+// task's history; queued tasks are updated in place.
+func (ts *TaskScheduler) setPriority(filter repositories.TaskFilter, priority TaskPriority) (int, error) {
+	rows, err := ts.repo.SetTaskPriority(filter, models.TaskPriority(priority))
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range rows {
+		id := rows[i].ID
+		queued := ts.queue.Update(id, func(task *Task) {
+			ts.update(task, func(task *Task) {
+				now := time.Now().UTC()
+				task.History = append(task.History, models.AttemptRecord{
+					Attempt:    task.Attempts,
+					Event:      models.EventPriorityChanged,
+					Detail:     fmt.Sprintf("%d -> %d", task.Priority, priority),
+					StartedAt:  now,
+					FinishedAt: now,
+				})
+				task.Priority = priority
+			})
+		})
+		switch {
+		case queued:
+			log.Printf("[Scheduler] Moved queued task %s to %s priority", id, priority.String())
+		case rows[i].Status == models.StatusBlocked:
+			// Not in the queue yet, so nothing else holds the cached copy
+			if _, ok := ts.cached(id); ok {
+				ts.remember(taskFromModel(&rows[i]))
+			}
+		}
+		// Otherwise a worker has just picked the task up and runs it as it is
+	}
+	return len(rows), nil
+}
@@ -2,22 +2,67 @@ package scheduler
 
 import (
 	"container/heap"
+	"context"
+	"encoding/json"
+	"maps"
+	"strconv"
 	"sync"
 	"time"
 
 	"distributed-task-scheduler/internal/metrics"
+	"distributed-task-scheduler/pkg/models"
 	"github.com/google/uuid"
 )
 
-// TaskPriority defines task priority levels
+// TaskPriority orders tasks: lower values run first. Any value from
+// MinPriority to MaxPriority is valid; High, Medium and Low name common ones.
 type TaskPriority int
 
 const (
-	High TaskPriority = iota
-	Medium
-	Low
+	MinPriority TaskPriority = 0
+	MaxPriority TaskPriority = 1000
+
+	High   TaskPriority = 100
+	Medium TaskPriority = 500
+	Low    TaskPriority = 900
 )
 
+// ParsePriority reads a priority given by name or as a number from
+// MinPriority to MaxPriority
+func ParsePriority(s string) (TaskPriority, bool) {
+	for _, level := range []TaskPriority{High, Medium, Low} {
+		if s == level.String() {
+			return level, true
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, false
+	}
+	p := TaskPriority(n)
+	return p, p.Valid()
+}
+
+// Valid reports whether the priority is within MinPriority..MaxPriority
+func (p TaskPriority) Valid() bool {
+	return p >= MinPriority && p <= MaxPriority
+}
+
+// Level buckets a priority into the nearest of High, Medium and Low. Per
+// priority defaults and metric labels go by level, which keeps the number of
+// series bounded.
+func (p TaskPriority) Level() TaskPriority {
+	switch {
+	case p < (High+Medium)/2:
+		return High
+	case p < (Medium+Low)/2:
+		return Medium
+	default:
+		return Low
+	}
+}
+
+// String names the three levels and prints other priorities as numbers
 func (p TaskPriority) String() string {
 	switch p {
 	case High:
@@ -27,17 +72,54 @@ func (p TaskPriority) String() string {
 	case Low:
 		return "low"
 	default:
-		return "unknown"
+		return strconv.Itoa(int(p))
 	}
 }
 
+// Queue hands tasks to workers in priority order
+type Queue interface {
+	PushTask(task *Task)
+	// PopTask blocks until a task is available. It returns nil once ctx is
+	// done or the queue is closed.
+	PopTask(ctx context.Context) *Task
+	Len() int
+	// Remove drops a task that hasn't been popped yet and reports whether it was queued
+	Remove(taskID string) bool
+	// Update applies fn to a task that hasn't been popped yet, restores the
+	// queue order it may have changed and reports whether the task was queued
+	Update(taskID string, fn func(task *Task)) bool
+	// Shared reports whether other nodes consume the same queue, in which
+	// case task state must be read from the DB rather than local memory
+	Shared() bool
+	// Close wakes every waiting PopTask and makes later ones return nil.
+	// Tasks still queued stay pending in the DB.
+	Close()
+}
+
 // Task represents a unit of work
 type Task struct {
-	ID        string       `json:"id"`
-	Priority  TaskPriority `json:"priority"`
-	Payload   interface{}  `json:"payload"`
-	CreatedAt time.Time    `json:"created_at"`
-	Status    string       `json:"status"`
+	ID        string                `json:"id"`
+	Type      string                `json:"type"`
+	Priority  TaskPriority          `json:"priority" swaggertype:"integer" minimum:"0" maximum:"1000"`
+	Payload   interface{}           `json:"payload"`
+	CreatedAt time.Time             `json:"created_at"`
+	Status    string                `json:"status"`
+	Labels    map[string]string     `json:"labels,omitempty"`
+	Result    interface{}           `json:"result,omitempty"`
+	Error     string                `json:"error,omitempty"`
+	Attempts  int                   `json:"attempts"`
+	Retry     RetryPolicy           `json:"retry"`
+	Timeout   time.Duration         `json:"timeout" swaggertype:"string" example:"30s"` // limit per attempt
+	History   models.AttemptHistory `json:"history,omitempty"`
+	RunAt     *time.Time            `json:"run_at,omitempty"` // not runnable before this time
+	// When the latest attempt started and when the task reached its final status
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Set on tasks submitted as part of a workflow
+	WorkflowID  string `json:"workflow_id,omitempty"`
+	WorkflowKey string `json:"workflow_key,omitempty"`
+	// CancelRequested is set while a running task is being cancelled
+	CancelRequested bool `json:"cancel_requested,omitempty"`
 }
 
 // TaskQueueItem wraps a Task for use in a heap
@@ -46,21 +128,39 @@ type TaskQueueItem struct {
 	index    int
 	priority TaskPriority
 	created  time.Time
+	runAt    time.Time
+	readyAt  time.Time // when the task entered the ready heap
+	rank     time.Time // aging order, see SetAging
 }
 
-// PriorityQueue is a threadsafe min-heap by priority
+// taskHeap implements heap.Interface; it is only touched with PriorityQueue.lock held
+type taskHeap []*TaskQueueItem
+
+// PriorityQueue is a threadsafe min-heap by priority. Tasks with a future
+// RunAt wait in a separate time-ordered heap until they are due.
 type PriorityQueue struct {
-	items []*TaskQueueItem
-	lock  sync.Mutex
-	cond  *sync.Cond
+	items   taskHeap
+	delayed delayHeap
+	byID    map[string]*TaskQueueItem // every queued item, ready or delayed
+	depth   levelCounts               // byID counted by priority level
+	timer   *time.Timer
+	// agingStep is how long a ready task waits to gain a priority level; zero disables aging
+	agingStep time.Duration
+	closed    bool
+	lock      sync.Mutex
+	cond      *sync.Cond
 }
 
+var _ Queue = (*PriorityQueue)(nil)
+
 func NewPriorityQueue() *PriorityQueue {
 	pq := &PriorityQueue{
-		items: make([]*TaskQueueItem, 0),
+		items: make(taskHeap, 0),
+		byID:  make(map[string]*TaskQueueItem),
+		depth: make(levelCounts),
 	}
 	pq.cond = sync.NewCond(&pq.lock)
-	heap.Init(pq)
+	heap.Init(&pq.items)
 	return pq
 }
 
@@ -79,59 +179,176 @@ func (pq *PriorityQueue) PushTask(task *Task) {
 		priority: task.Priority,
 		created:  task.CreatedAt,
 	}
-	heap.Push(pq, item)
+	pq.byID[task.ID] = item
+	pq.depth.add(item.priority, 1)
+	if task.RunAt != nil && task.RunAt.After(time.Now()) {
+		item.runAt = *task.RunAt
+		pq.pushDelayed(item)
+		return
+	}
+	pq.ready(item, time.Now())
+	heap.Push(&pq.items, item)
 	metrics.TasksInQueue.Inc()
 	pq.cond.Signal()
 }
 
-func (pq *PriorityQueue) PopTask() *Task {
+func (pq *PriorityQueue) PopTask(ctx context.Context) *Task {
 	pq.lock.Lock()
 	defer pq.lock.Unlock()
 
-	for len(pq.items) == 0 {
-		pq.cond.Wait()
+	if !waitReady(ctx, pq.cond, func() bool { return len(pq.items) > 0 }, func() bool { return pq.closed }) {
+		return nil
 	}
 
-	item := heap.Pop(pq).(*TaskQueueItem)
+	item := heap.Pop(&pq.items).(*TaskQueueItem)
+	delete(pq.byID, item.Task.ID)
+	pq.depth.add(item.priority, -1)
 	metrics.TasksInQueue.Dec()
+	now := time.Now()
+	level := item.priority.Level().String()
+	metrics.TaskQueueWait.WithLabelValues(level).Observe(now.Sub(item.readyAt).Seconds())
+	metrics.TaskEffectivePriority.WithLabelValues(level).Observe(pq.effectivePriority(item, now))
 	return item.Task
 }
 
-func (pq PriorityQueue) Less(i, j int) bool {
-	if pq.items[i].priority == pq.items[j].priority {
-		return pq.items[i].created.Before(pq.items[j].created)
+// Remove takes a queued task out of whichever heap holds it
+func (pq *PriorityQueue) Remove(taskID string) bool {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	item, ok := pq.byID[taskID]
+	if !ok {
+		return false
+	}
+	delete(pq.byID, taskID)
+	pq.depth.add(item.priority, -1)
+	if item.index < len(pq.delayed) && pq.delayed[item.index] == item {
+		heap.Remove(&pq.delayed, item.index)
+		metrics.TasksDelayed.Dec()
+		pq.armTimer()
+		return true
+	}
+	heap.Remove(&pq.items, item.index)
+	metrics.TasksInQueue.Dec()
+	return true
+}
+
+// Update changes a queued task in place. A ready task is moved to its new
+// place in the heap with heap.Fix; a delayed one keeps its run time and is
+// ordered by the new priority once it is due.
+func (pq *PriorityQueue) Update(taskID string, fn func(task *Task)) bool {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	item, ok := pq.byID[taskID]
+	if !ok {
+		return false
+	}
+	fn(item.Task)
+	pq.depth.add(item.priority, -1)
+	item.priority = item.Task.Priority
+	pq.depth.add(item.priority, 1)
+	if item.index < len(pq.delayed) && pq.delayed[item.index] == item {
+		return true
+	}
+	item.rank = pq.rank(item)
+	heap.Fix(&pq.items, item.index)
+	return true
+}
+
+// Shared is false: the heap only lives in this process
+func (pq *PriorityQueue) Shared() bool { return false }
+
+func (pq *PriorityQueue) Close() {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+	pq.closed = true
+	pq.cond.Broadcast()
+}
+
+// waitReady waits on cond until ready reports true. It gives up and returns
+// false as soon as ctx is done or closed reports true. Caller holds cond.L.
+func waitReady(ctx context.Context, cond *sync.Cond, ready func() bool, closed func() bool) bool {
+	// Broadcast under the lock so the wakeup can't slip in between a
+	// waiter's check of ctx and its Wait
+	stop := context.AfterFunc(ctx, func() {
+		cond.L.Lock()
+		defer cond.L.Unlock()
+		cond.Broadcast()
+	})
+	defer stop()
+
+	for {
+		if closed() || ctx.Err() != nil {
+			return false
+		}
+		if ready() {
+			return true
+		}
+		cond.Wait()
+	}
+}
+
+// Depth returns how many tasks are queued, ready or delayed, in total and by priority level
+func (pq *PriorityQueue) Depth() (int, map[TaskPriority]int) {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+	return len(pq.byID), maps.Clone(pq.depth)
+}
+
+func (h taskHeap) Len() int { return len(h) }
+
+func (h taskHeap) Less(i, j int) bool {
+	// Ranks are all zero unless aging is on
+	if !h[i].rank.Equal(h[j].rank) {
+		return h[i].rank.Before(h[j].rank)
 	}
-	return pq.items[i].priority < pq.items[j].priority
+	if h[i].priority == h[j].priority {
+		return h[i].created.Before(h[j].created)
+	}
+	return h[i].priority < h[j].priority
 }
 
-func (pq PriorityQueue) Swap(i, j int) {
-	pq.items[i], pq.items[j] = pq.items[j], pq.items[i]
-	pq.items[i].index = i
-	pq.items[j].index = j
+func (h taskHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
 }
 
-func (pq *PriorityQueue) Push(x interface{}) {
+func (h *taskHeap) Push(x interface{}) {
 	item := x.(*TaskQueueItem)
-	item.index = len(pq.items)
-	pq.items = append(pq.items, item)
+	item.index = len(*h)
+	*h = append(*h, item)
 }
 
-func (pq *PriorityQueue) Pop() interface{} {
-	old := pq.items
+func (h *taskHeap) Pop() interface{} {
+	old := *h
 	n := len(old)
 	item := old[n-1]
 	old[n-1] = nil
 	item.index = -1
-	pq.items = old[:n-1]
+	*h = old[:n-1]
 	return item
 }
 
-func NewTask(priority TaskPriority, payload interface{}) *Task {
+func NewTask(taskType string, priority TaskPriority, payload interface{}) *Task {
 	return &Task{
 		ID:        uuid.New().String(),
+		Type:      taskType,
 		Priority:  priority,
 		Payload:   payload,
 		CreatedAt: time.Now().UTC(),
-		Status:    "pending",
+		Status:    models.StatusPending,
+		Retry:     DefaultRetryPolicy(priority),
+		Timeout:   DefaultTimeout(priority),
 	}
 }
+
+// MarshalJSON renders the timeout as a string like "30s"
+func (t Task) MarshalJSON() ([]byte, error) {
+	type plain Task
+	return json.Marshal(struct {
+		plain
+		Timeout string `json:"timeout"`
+	}{plain(t), t.Timeout.String()})
+}
@@ -1,15 +1,17 @@
 package scheduler
 
 import (
+	"context"
 	"testing"
+	"time"
 )
 
 func TestPriorityQueueOrdering(t *testing.T) {
 	q := NewPriorityQueue()
 
-	task1 := NewTask(Low, interface{}(`{"data":1}`))
-	task2 := NewTask(High, interface{}(`{"data":2}`))
-	task3 := NewTask(Medium, interface{}(`{"data":3}`))
+	task1 := NewTask("echo", Low, interface{}(`{"data":1}`))
+	task2 := NewTask("echo", High, interface{}(`{"data":2}`))
+	task3 := NewTask("echo", Medium, interface{}(`{"data":3}`))
 
 	q.PushTask(task1)
 	q.PushTask(task2)
@@ -19,18 +21,237 @@ func TestPriorityQueueOrdering(t *testing.T) {
 		t.Fatalf("Expected 3 tasks, got %d", q.Len())
 	}
 
-	t1 := q.PopTask()
+	t1 := q.PopTask(context.Background())
 	if t1.Priority != High {
 		t.Fatalf("Expected high priority first, got %s", t1.Priority.String())
 	}
 
-	t2 := q.PopTask()
+	t2 := q.PopTask(context.Background())
 	if t2.Priority != Medium {
 		t.Fatalf("Expected medium priority second, got %s", t2.Priority.String())
 	}
 
-	t3 := q.PopTask()
+	t3 := q.PopTask(context.Background())
 	if t3.Priority != Low {
 		t.Fatalf("Expected low priority third, got %s", t3.Priority.String())
 	}
 }
+
+func TestPriorityQueueDelayedTasks(t *testing.T) {
+	q := NewPriorityQueue()
+
+	runAt := time.Now().Add(150 * time.Millisecond)
+	delayed := NewTask("echo", High, nil)
+	delayed.RunAt = &runAt
+	ready := NewTask("echo", Low, nil)
+
+	q.PushTask(delayed)
+	q.PushTask(ready)
+
+	if q.Len() != 1 || q.Delayed() != 1 {
+		t.Fatalf("Expected 1 ready and 1 delayed task, got %d and %d", q.Len(), q.Delayed())
+	}
+
+	if got := q.PopTask(context.Background()); got.ID != ready.ID {
+		t.Fatalf("Expected the ready low priority task first, got %s", got.Priority.String())
+	}
+
+	got := q.PopTask(context.Background())
+	if got.ID != delayed.ID {
+		t.Fatalf("Expected the delayed task, got %s", got.ID)
+	}
+	if time.Now().Before(runAt) {
+		t.Fatalf("Delayed task released before its run time")
+	}
+}
+
+func TestPriorityQueueRemove(t *testing.T) {
+	q := NewPriorityQueue()
+
+	runAt := time.Now().Add(time.Hour)
+	delayed := NewTask("echo", High, nil)
+	delayed.RunAt = &runAt
+	first := NewTask("echo", High, nil)
+	second := NewTask("echo", Medium, nil)
+	third := NewTask("echo", Low, nil)
+
+	for _, task := range []*Task{delayed, first, second, third} {
+		q.PushTask(task)
+	}
+
+	if !q.Remove(second.ID) || !q.Remove(delayed.ID) {
+		t.Fatal("Expected queued tasks to be removed")
+	}
+	if q.Remove(second.ID) {
+		t.Fatal("Expected a removed task to be gone")
+	}
+	if q.Len() != 2 || q.Delayed() != 0 {
+		t.Fatalf("Expected 2 ready and no delayed tasks, got %d and %d", q.Len(), q.Delayed())
+	}
+
+	if got := q.PopTask(context.Background()); got.ID != first.ID {
+		t.Fatalf("Expected the high priority task, got %s", got.Priority.String())
+	}
+	if got := q.PopTask(context.Background()); got.ID != third.ID {
+		t.Fatalf("Expected the low priority task, got %s", got.Priority.String())
+	}
+	if q.Remove(first.ID) {
+		t.Fatal("Expected a popped task not to be removable")
+	}
+}
+
+func TestPriorityQueueUpdate(t *testing.T) {
+	q := NewPriorityQueue()
+
+	high := NewTask("echo", High, nil)
+	medium := NewTask("echo", Medium, nil)
+	low := NewTask("echo", Low, nil)
+	for _, task := range []*Task{high, medium, low} {
+		q.PushTask(task)
+	}
+
+	if !q.Update(low.ID, func(task *Task) { task.Priority = High }) {
+		t.Fatal("Expected the queued task to be updated")
+	}
+	if !q.Update(high.ID, func(task *Task) { task.Priority = Low }) {
+		t.Fatal("Expected the queued task to be updated")
+	}
+
+	for _, want := range []*Task{low, medium, high} {
+		if got := q.PopTask(context.Background()); got.ID != want.ID {
+			t.Fatalf("Expected task %s (%s) next, got %s (%s)", want.ID, want.Priority, got.ID, got.Priority)
+		}
+	}
+	if q.Update(low.ID, func(task *Task) { task.Priority = Medium }) {
+		t.Fatal("Expected a popped task not to be updated")
+	}
+}
+
+func TestPriorityQueueAging(t *testing.T) {
+	q := NewPriorityQueue()
+	q.SetAging(20 * time.Millisecond)
+
+	low := NewTask("echo", Low, nil)
+	q.PushTask(low)
+	time.Sleep(60 * time.Millisecond)
+
+	// Waiting three steps lifts the low task above fresh high ones
+	high := NewTask("echo", High, nil)
+	medium := NewTask("echo", Medium, nil)
+	q.PushTask(medium)
+	q.PushTask(high)
+
+	for _, want := range []*Task{low, high, medium} {
+		if got := q.PopTask(context.Background()); got.ID != want.ID {
+			t.Fatalf("Expected the %s task next, got the %s one", want.Priority, got.Priority)
+		}
+	}
+}
+
+func TestPriorityQueueAgingKeepsOrderOfFreshTasks(t *testing.T) {
+	q := NewPriorityQueue()
+	q.SetAging(time.Hour)
+
+	low := NewTask("echo", Low, nil)
+	medium := NewTask("echo", Medium, nil)
+	high := NewTask("echo", High, nil)
+	for _, task := range []*Task{low, medium, high} {
+		q.PushTask(task)
+	}
+
+	for _, want := range []*Task{high, medium, low} {
+		if got := q.PopTask(context.Background()); got.ID != want.ID {
+			t.Fatalf("Expected the %s task next, got the %s one", want.Priority, got.Priority)
+		}
+	}
+}
+
+func TestPriorityQueueNumericPriorities(t *testing.T) {
+	q := NewPriorityQueue()
+	for _, p := range []TaskPriority{750, High, 250, Low, 0, Medium} {
+		q.PushTask(NewTask("echo", p, nil))
+	}
+	for _, want := range []TaskPriority{0, High, 250, Medium, 750, Low} {
+		if got := q.PopTask(context.Background()).Priority; got != want {
+			t.Fatalf("Expected priority %s next, got %s", want, got)
+		}
+	}
+}
+
+func TestParsePriorityAndLevel(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  TaskPriority
+		level TaskPriority
+	}{
+		{"high", High, High},
+		{"medium", Medium, Medium},
+		{"low", Low, Low},
+		{"0", 0, High},
+		{"299", 299, High},
+		{"300", 300, Medium},
+		{"699", 699, Medium},
+		{"700", 700, Low},
+		{"1000", MaxPriority, Low},
+	}
+	for _, tt := range tests {
+		got, ok := ParsePriority(tt.in)
+		if !ok || got != tt.want {
+			t.Errorf("ParsePriority(%q) = %d, %v; want %d", tt.in, got, ok, tt.want)
+		}
+		if got.Level() != tt.level {
+			t.Errorf("Level of %d = %s, want %s", got, got.Level(), tt.level)
+		}
+	}
+	for _, in := range []string{"", "urgent", "-1", "1001", "1.5"} {
+		if _, ok := ParsePriority(in); ok {
+			t.Errorf("Expected ParsePriority(%q) to fail", in)
+		}
+	}
+}
+
+func TestPopTaskReturnsOnCancelAndClose(t *testing.T) {
+	fq, err := NewFairQueue(DefaultFairWeights, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []Queue{NewPriorityQueue(), fq} {
+		ctx, cancel := context.WithCancel(context.Background())
+		popped := make(chan *Task)
+		go func() { popped <- q.PopTask(ctx) }()
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+		select {
+		case task := <-popped:
+			if task != nil {
+				t.Fatalf("%T: expected nil after cancel, got task %s", q, task.ID)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%T: PopTask didn't return after its context was cancelled", q)
+		}
+
+		// Close wakes every waiter, not just one
+		const waiters = 3
+		for i := 0; i < waiters; i++ {
+			go func() { popped <- q.PopTask(context.Background()) }()
+		}
+		time.Sleep(10 * time.Millisecond)
+		q.Close()
+		for i := 0; i < waiters; i++ {
+			select {
+			case task := <-popped:
+				if task != nil {
+					t.Fatalf("%T: expected nil after Close, got task %s", q, task.ID)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("%T: PopTask didn't return after Close", q)
+			}
+		}
+
+		// A closed queue hands out nothing, even with tasks in it
+		q.PushTask(NewTask("echo", High, nil))
+		if task := q.PopTask(context.Background()); task != nil {
+			t.Fatalf("%T: expected nil from a closed queue, got task %s", q, task.ID)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"distributed-task-scheduler/internal/metrics"
+)
+
+// ReclaimOrphanedTasks requeues running tasks whose owner node is dead or
+// whose lease expired, as well as pending tasks that were queued in the memory
+// of a node that is gone. It returns how many tasks were reclaimed.
+func (ts *TaskScheduler) ReclaimOrphanedTasks() (int, error) {
+	tasks, err := ts.repo.ReclaimOrphanedTasks(errTaskCancelled.Error(), ts.holder())
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range tasks {
+		task := taskFromModel(&tasks[i])
+
+		ts.remember(task)
+		ts.queue.PushTask(task)
+		log.Printf("[Scheduler] Reclaimed task %s: %s", task.ID, task.Error)
+	}
+	metrics.TasksReclaimed.Add(float64(len(tasks)))
+	return len(tasks), nil
+}
+
+// Reclaimer periodically reclaims orphaned tasks while this node is leader.
+// It also settles blocked workflow tasks whose release was missed because a
+// node died right after finishing their last parent. On every node it keeps
+// the dead-letter queue size metric in step with the database.
+type Reclaimer struct {
+	ts       *TaskScheduler
+	isLeader func() bool
+	interval time.Duration
+	stopChan chan struct{}
+	once     sync.Once
+}
+
+func NewReclaimer(ts *TaskScheduler, isLeader func() bool, interval time.Duration) *Reclaimer {
+	return &Reclaimer{
+		ts:       ts,
+		isLeader: isLeader,
+		interval: interval,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins the reclaim loop
+func (r *Reclaimer) Start() {
+	ticker := time.NewTicker(r.interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.ts.refreshDeadLetterGauge()
+				if !r.isLeader() {
+					continue
+				}
+				if _, err := r.ts.ReclaimOrphanedTasks(); err != nil {
+					log.Printf("[Reclaimer] Failed to reclaim orphaned tasks: %v", err)
+				}
+				if _, err := r.ts.ResolveBlockedTasks(); err != nil {
+					log.Printf("[Reclaimer] Failed to resolve blocked tasks: %v", err)
+				}
+			case <-r.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the reclaim loop
+func (r *Reclaimer) Stop() {
+	r.once.Do(func() {
+		close(r.stopChan)
+	})
+}
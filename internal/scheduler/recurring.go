@@ -0,0 +1,342 @@
+package scheduler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"distributed-task-scheduler/pkg/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxFiresPerEvaluation bounds how many missed runs catch_up=all replays for
+// one schedule in a single pass; the rest are picked up on the next tick.
+const maxFiresPerEvaluation = 100
+
+// ScheduleSpec describes a recurring task definition
+type ScheduleSpec struct {
+	Name     string
+	Cron     string
+	Timezone string // IANA name, defaults to UTC
+	Type     string
+	Priority TaskPriority
+	Payload  interface{} // string values may use {{.ScheduleID}}, {{.ScheduleName}} and {{.FireTime}}
+	CatchUp  string      // empty means the runner's default policy
+}
+
+// fireData is what payload templates are rendered with
+type fireData struct {
+	ScheduleID   string
+	ScheduleName string
+	FireTime     time.Time
+}
+
+// CreateSchedule validates and stores a recurring task definition
+func (ts *TaskScheduler) CreateSchedule(spec ScheduleSpec) (*models.Schedule, error) {
+	if spec.Timezone == "" {
+		spec.Timezone = "UTC"
+	}
+	if _, err := ParseCron(spec.Cron); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if _, err := time.LoadLocation(spec.Timezone); err != nil {
+		return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalid, spec.Timezone)
+	}
+	if !validCatchUp(spec.CatchUp) {
+		return nil, fmt.Errorf("%w: catch_up must be one of none, last, all", ErrInvalid)
+	}
+	if _, err := renderPayload(spec.Payload, fireData{FireTime: time.Now()}); err != nil {
+		return nil, fmt.Errorf("%w: payload template: %v", ErrInvalid, err)
+	}
+
+	schedule := &models.Schedule{
+		ID:        uuid.New().String(),
+		Name:      spec.Name,
+		Cron:      spec.Cron,
+		Timezone:  spec.Timezone,
+		Type:      spec.Type,
+		Priority:  models.TaskPriority(spec.Priority),
+		Payload:   spec.Payload,
+		CatchUp:   spec.CatchUp,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := ts.repo.CreateSchedule(schedule); err != nil {
+		return nil, err
+	}
+	log.Printf("[Scheduler] Created schedule %s (%q, %s %s)", schedule.ID, schedule.Name, schedule.Cron, schedule.Timezone)
+	return schedule, nil
+}
+
+// ListSchedules returns every schedule, oldest first
+func (ts *TaskScheduler) ListSchedules() ([]models.Schedule, error) {
+	schedules, err := ts.repo.ListSchedules()
+	for i := range schedules {
+		schedules[i].Payload = decodeJSON(schedules[i].Payload)
+	}
+	return schedules, err
+}
+
+func (ts *TaskScheduler) GetSchedule(id string) (*models.Schedule, error) {
+	schedule, err := ts.repo.GetSchedule(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	schedule.Payload = decodeJSON(schedule.Payload)
+	return schedule, nil
+}
+
+// DeleteSchedule stops a schedule from firing; tasks it already submitted are kept
+func (ts *TaskScheduler) DeleteSchedule(id string) error {
+	found, err := ts.repo.DeleteSchedule(id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func validCatchUp(policy string) bool {
+	switch policy {
+	case "", models.CatchUpNone, models.CatchUpLast, models.CatchUpAll:
+		return true
+	}
+	return false
+}
+
+// ScheduleRunner fires recurring schedules. It only does work while isLeader
+// reports true, so exactly one node in the cluster evaluates schedules.
+type ScheduleRunner struct {
+	ts       *TaskScheduler
+	isLeader func() bool
+	interval time.Duration
+	catchUp  string
+	stopChan chan struct{}
+	once     sync.Once
+}
+
+// NewScheduleRunner checks schedules every interval. catchUp is the policy
+// for schedules that don't set their own.
+func NewScheduleRunner(ts *TaskScheduler, isLeader func() bool, interval time.Duration, catchUp string) *ScheduleRunner {
+	if !validCatchUp(catchUp) || catchUp == "" {
+		catchUp = models.CatchUpLast
+	}
+	return &ScheduleRunner{
+		ts:       ts,
+		isLeader: isLeader,
+		interval: interval,
+		catchUp:  catchUp,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins evaluating schedules
+func (sr *ScheduleRunner) Start() {
+	ticker := time.NewTicker(sr.interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if sr.isLeader() {
+					sr.evaluate(time.Now())
+				}
+			case <-sr.stopChan:
+				return
+			}
+		}
+	}()
+	log.Printf("[Schedules] Runner started (interval %s, default catch-up %q)", sr.interval, sr.catchUp)
+}
+
+// Stop ends the evaluation loop
+func (sr *ScheduleRunner) Stop() {
+	sr.once.Do(func() {
+		close(sr.stopChan)
+	})
+}
+
+func (sr *ScheduleRunner) evaluate(now time.Time) {
+	schedules, err := sr.ts.repo.ListSchedules()
+	if err != nil {
+		log.Printf("[Schedules] Failed to load schedules: %v", err)
+		return
+	}
+	for i := range schedules {
+		sr.evaluateSchedule(&schedules[i], now)
+	}
+}
+
+// missedAfter is how late a run may be evaluated and still count as on time
+// rather than missed.
+func (sr *ScheduleRunner) missedAfter() time.Duration {
+	if grace := 2 * sr.interval; grace > time.Minute {
+		return grace
+	}
+	return time.Minute
+}
+
+// evaluateSchedule fires the runs due since last_fire_at. Each firing submits
+// a task whose ID is derived from the schedule and the fire time and then
+// advances last_fire_at with a compare-and-set, so a new leader that picks
+// up halfway through neither repeats nor loses a run.
+func (sr *ScheduleRunner) evaluateSchedule(s *models.Schedule, now time.Time) {
+	cron, err := ParseCron(s.Cron)
+	if err != nil {
+		log.Printf("[Schedules] Schedule %s has invalid cron %q: %v", s.ID, s.Cron, err)
+		return
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		log.Printf("[Schedules] Schedule %s has invalid timezone %q: %v", s.ID, s.Timezone, err)
+		return
+	}
+	policy := s.CatchUp
+	if policy == "" {
+		policy = sr.catchUp
+	}
+
+	from := s.CreatedAt
+	if s.LastFireAt != nil {
+		from = *s.LastFireAt
+	}
+	runs := dueRuns(cron, from.In(loc), now, sr.missedAfter(), policy)
+
+	prev := s.LastFireAt
+	for _, run := range runs {
+		if run.fire {
+			if err := sr.fire(s, run.at); err != nil {
+				log.Printf("[Schedules] Failed to fire schedule %s for %s: %v", s.ID, run.at.Format(time.RFC3339), err)
+				return
+			}
+		}
+		// Skipped runs only need to move the marker past them once
+		if !run.fire && !run.last {
+			continue
+		}
+		at := run.at.UTC()
+		advanced, err := sr.ts.repo.AdvanceSchedule(s.ID, prev, at)
+		if err != nil {
+			log.Printf("[Schedules] Failed to record firing of schedule %s: %v", s.ID, err)
+			return
+		}
+		if !advanced {
+			// Another node got there first
+			return
+		}
+		prev = &at
+	}
+}
+
+func (sr *ScheduleRunner) fire(s *models.Schedule, at time.Time) error {
+	taskID := uuid.NewSHA1(uuid.NameSpaceURL, []byte("schedule:"+s.ID+"@"+at.UTC().Format(time.RFC3339))).String()
+	exists, err := sr.ts.repo.TaskExists(taskID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		// Submitted by a previous leader that died before recording it
+		return nil
+	}
+
+	payload, err := renderPayload(decodeJSON(s.Payload), fireData{ScheduleID: s.ID, ScheduleName: s.Name, FireTime: at})
+	if err != nil {
+		return err
+	}
+	_, err = sr.ts.SubmitTask(TaskSpec{
+		ID:       taskID,
+		Type:     s.Type,
+		Priority: TaskPriority(s.Priority),
+		Payload:  payload,
+	})
+	if err == nil {
+		log.Printf("[Schedules] Schedule %s fired for %s as task %s", s.ID, at.Format(time.RFC3339), taskID)
+	}
+	return err
+}
+
+type scheduledRun struct {
+	at   time.Time
+	fire bool // false when the catch-up policy skips the run
+	last bool
+}
+
+// dueRuns lists the cron times in (from, now] and marks which ones fire. Runs
+// older than missedAfter were missed and are handled by the catch-up policy:
+// under all they are replayed up to maxFiresPerEvaluation at a time, under
+// last and none only the latest of them is listed, however many there were.
+func dueRuns(cron *CronSchedule, from, now time.Time, missedAfter time.Duration, policy string) []scheduledRun {
+	var runs []scheduledRun
+	t := cron.Next(from)
+	if policy != models.CatchUpAll {
+		cutoff := now.Add(-missedAfter)
+		var lastMissed time.Time
+		for ; !t.IsZero() && t.Before(cutoff); t = cron.Next(t) {
+			lastMissed = t
+		}
+		if !lastMissed.IsZero() {
+			runs = append(runs, scheduledRun{at: lastMissed, fire: policy == models.CatchUpLast})
+		}
+	}
+	for ; !t.IsZero() && !t.After(now) && len(runs) < maxFiresPerEvaluation; t = cron.Next(t) {
+		runs = append(runs, scheduledRun{at: t, fire: true})
+	}
+	if len(runs) == 0 {
+		return nil
+	}
+	runs[len(runs)-1].last = true
+	return runs
+}
+
+// renderPayload executes every string in the payload that contains a
+// template action; other values are copied as they are.
+func renderPayload(payload interface{}, data fireData) (interface{}, error) {
+	switch v := payload.(type) {
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		tmpl, err := template.New("payload").Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		return buf.String(), nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			rendered, err := renderPayload(item, data)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = rendered
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered, err := renderPayload(item, data)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,75 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// errNoHandler fails tasks of a type no handler is registered for. Retrying
+// them can't help, so they fail on their first attempt.
+var errNoHandler = errors.New("no handler registered")
+
+// HandlerFunc executes the payload of a task and returns its result.
+// Handlers should return promptly once ctx is done.
+type HandlerFunc func(ctx context.Context, payload interface{}) (interface{}, error)
+
+// HandlerRegistry maps task types to the handlers that execute them
+type HandlerRegistry struct {
+	handlers map[string]HandlerFunc
+	mu       sync.RWMutex
+}
+
+// NewHandlerRegistry returns an empty registry
+func NewHandlerRegistry() *HandlerRegistry {
+	return &HandlerRegistry{
+		handlers: make(map[string]HandlerFunc),
+	}
+}
+
+// Register binds a handler to a task type, replacing any previous one
+func (r *HandlerRegistry) Register(taskType string, handler HandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[taskType] = handler
+}
+
+// Lookup returns the handler registered for a task type
+func (r *HandlerRegistry) Lookup(taskType string) (HandlerFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	handler, ok := r.handlers[taskType]
+	return handler, ok
+}
+
+// Types lists the registered task types in sorted order
+func (r *HandlerRegistry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]string, 0, len(r.handlers))
+	for t := range r.handlers {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Execute runs the handler for taskType, turning a missing handler or a
+// panic inside the handler into an error.
+func (r *HandlerRegistry) Execute(ctx context.Context, taskType string, payload interface{}) (result interface{}, err error) {
+	handler, ok := r.Lookup(taskType)
+	if !ok {
+		return nil, fmt.Errorf("%w for task type %q", errNoHandler, taskType)
+	}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			result = nil
+			err = fmt.Errorf("handler for task type %q panicked: %v", taskType, rec)
+		}
+	}()
+
+	return handler(ctx, payload)
+}
@@ -0,0 +1,38 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestHandlerRegistryExecute(t *testing.T) {
+	r := NewHandlerRegistry()
+	r.Register("double", func(ctx context.Context, payload interface{}) (interface{}, error) {
+		return payload.(int) * 2, nil
+	})
+	r.Register("broken", func(ctx context.Context, payload interface{}) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+	r.Register("panics", func(ctx context.Context, payload interface{}) (interface{}, error) {
+		panic("unexpected")
+	})
+
+	result, err := r.Execute(context.Background(), "double", 21)
+	if err != nil || result != 42 {
+		t.Fatalf("Expected 42, got %v (err %v)", result, err)
+	}
+
+	if _, err := r.Execute(context.Background(), "broken", nil); err == nil || err.Error() != "boom" {
+		t.Fatalf("Expected handler error, got %v", err)
+	}
+
+	if _, err := r.Execute(context.Background(), "panics", nil); err == nil || !strings.Contains(err.Error(), "panicked") {
+		t.Fatalf("Expected panic to be converted to an error, got %v", err)
+	}
+
+	if _, err := r.Execute(context.Background(), "missing", nil); !errors.Is(err, errNoHandler) {
+		t.Fatalf("Expected unknown type error, got %v", err)
+	}
+}
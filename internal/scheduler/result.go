@@ -0,0 +1,75 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+)
+
+// resultPollInterval is how often a waiting client re-reads a task, which
+// catches tasks that finish on another node
+const resultPollInterval = time.Second
+
+// WaitForResult blocks until the task has reached a final status or ctx is
+// done. It returns the task as last seen and whether it has finished.
+func (ts *TaskScheduler) WaitForResult(ctx context.Context, id string) (*Task, bool, error) {
+	ticker := time.NewTicker(resultPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Watch before looking so a task finishing in between isn't missed
+		done, unwatch := ts.watch(id)
+		task, ok := ts.GetTask(id)
+		if !ok {
+			unwatch()
+			return nil, false, ErrNotFound
+		}
+		if isFinished(task.Status) {
+			unwatch()
+			return task, true, nil
+		}
+
+		select {
+		case <-done:
+		case <-ticker.C:
+		case <-ctx.Done():
+			unwatch()
+			return task, false, nil
+		}
+		unwatch()
+	}
+}
+
+// watch returns a channel that is closed once this node sees the task finish
+func (ts *TaskScheduler) watch(id string) (<-chan struct{}, func()) {
+	ch := make(chan struct{})
+	ts.waitersMutex.Lock()
+	ts.waiters[id] = append(ts.waiters[id], ch)
+	ts.waitersMutex.Unlock()
+
+	return ch, func() {
+		ts.waitersMutex.Lock()
+		defer ts.waitersMutex.Unlock()
+		chans := ts.waiters[id]
+		for i, c := range chans {
+			if c == ch {
+				chans = append(chans[:i], chans[i+1:]...)
+				break
+			}
+		}
+		if len(chans) == 0 {
+			delete(ts.waiters, id)
+		} else {
+			ts.waiters[id] = chans
+		}
+	}
+}
+
+// notifyFinished wakes everyone waiting for the task
+func (ts *TaskScheduler) notifyFinished(id string) {
+	ts.waitersMutex.Lock()
+	defer ts.waitersMutex.Unlock()
+	for _, ch := range ts.waiters[id] {
+		close(ch)
+	}
+	delete(ts.waiters, id)
+}
@@ -0,0 +1,58 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"distributed-task-scheduler/pkg/models"
+)
+
+func TestWaitForResult(t *testing.T) {
+	ts := NewTaskScheduler(NewPriorityQueue(), nil)
+	task := NewTask("echo", High, nil)
+	ts.remember(task)
+
+	// Still running when the client gives up
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, finished, err := ts.WaitForResult(ctx, task.ID); err != nil || finished {
+		t.Fatalf("Expected an unfinished task, got finished=%v err=%v", finished, err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		done := *task
+		done.Status = models.StatusCompleted
+		done.Result = "done"
+		ts.remember(&done)
+		ts.TaskFinished(&done)
+	}()
+
+	start := time.Now()
+	got, finished, err := ts.WaitForResult(context.Background(), task.ID)
+	if err != nil || !finished || got.Result != "done" {
+		t.Fatalf("Expected the finished task, got %+v finished=%v err=%v", got, finished, err)
+	}
+	if elapsed := time.Since(start); elapsed >= resultPollInterval {
+		t.Fatalf("Expected to be woken by the finish, waited %s", elapsed)
+	}
+}
+
+func TestGetTaskReturnsCopy(t *testing.T) {
+	ts := NewTaskScheduler(NewPriorityQueue(), nil)
+	task := NewTask("echo", High, nil)
+	ts.remember(task)
+
+	got, ok := ts.GetTask(task.ID)
+	if !ok || got == task {
+		t.Fatalf("Expected a copy of the cached task, got %p for %p", got, task)
+	}
+	ts.update(task, func(task *Task) {
+		task.Status = models.StatusCompleted
+		task.History = append(task.History, models.AttemptRecord{Attempt: 1})
+	})
+	if got.Status != models.StatusPending || len(got.History) != 0 {
+		t.Fatalf("Expected the copy to keep its state, got %s with %d attempts in history", got.Status, len(got.History))
+	}
+}
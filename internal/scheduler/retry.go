@@ -0,0 +1,80 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy controls how often a failing task is re-run and how long to wait in between
+type RetryPolicy struct {
+	MaxAttempts    int           `json:"max_attempts"`
+	InitialBackoff time.Duration `json:"initial_backoff" swaggertype:"string" example:"1s"`
+	Multiplier     float64       `json:"multiplier"`
+	MaxBackoff     time.Duration `json:"max_backoff" swaggertype:"string" example:"1m0s"`
+	Jitter         float64       `json:"jitter"` // fraction of the backoff to randomise, 0..1
+}
+
+var defaultRetryPolicies = map[TaskPriority]RetryPolicy{
+	High:   {MaxAttempts: 5, InitialBackoff: time.Second, Multiplier: 2, MaxBackoff: time.Minute, Jitter: 0.2},
+	Medium: {MaxAttempts: 3, InitialBackoff: 2 * time.Second, Multiplier: 2, MaxBackoff: 2 * time.Minute, Jitter: 0.2},
+	Low:    {MaxAttempts: 2, InitialBackoff: 5 * time.Second, Multiplier: 2, MaxBackoff: 5 * time.Minute, Jitter: 0.2},
+}
+
+// DefaultRetryPolicy returns the policy used when a submission doesn't set
+// one; priorities between the named levels use their level's policy
+func DefaultRetryPolicy(priority TaskPriority) RetryPolicy {
+	return defaultRetryPolicies[priority.Level()]
+}
+
+// Validate rejects policies that can't be applied
+func (p RetryPolicy) Validate() error {
+	switch {
+	case p.MaxAttempts < 1:
+		return errors.New("max_attempts must be at least 1")
+	case p.InitialBackoff < 0 || p.MaxBackoff < 0:
+		return errors.New("backoff durations must not be negative")
+	case p.MaxBackoff < p.InitialBackoff:
+		return errors.New("max_backoff must not be less than initial_backoff")
+	case p.Multiplier < 1:
+		return errors.New("multiplier must be at least 1")
+	case p.Jitter < 0 || p.Jitter > 1:
+		return errors.New("jitter must be between 0 and 1")
+	}
+	return nil
+}
+
+// Backoff returns how long to wait before the attempt that follows attempt
+// number `attempt` (1-based).
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	backoff := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		backoff *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(backoff)
+}
+
+// MarshalJSON renders durations as strings like "1.5s"
+func (p RetryPolicy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		MaxAttempts    int     `json:"max_attempts"`
+		InitialBackoff string  `json:"initial_backoff"`
+		Multiplier     float64 `json:"multiplier"`
+		MaxBackoff     string  `json:"max_backoff"`
+		Jitter         float64 `json:"jitter"`
+	}{
+		MaxAttempts:    p.MaxAttempts,
+		InitialBackoff: p.InitialBackoff.String(),
+		Multiplier:     p.Multiplier,
+		MaxBackoff:     p.MaxBackoff.String(),
+		Jitter:         p.Jitter,
+	})
+}
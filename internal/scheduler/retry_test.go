@@ -0,0 +1,45 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second, Multiplier: 2, MaxBackoff: 5 * time.Second}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	for i, want := range expected {
+		if got := p.Backoff(i + 1); got != want {
+			t.Fatalf("Attempt %d: expected backoff %s, got %s", i+1, want, got)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		got := p.Backoff(1)
+		if got < 500*time.Millisecond || got > 1500*time.Millisecond {
+			t.Fatalf("Jittered backoff %s outside of [0.5s, 1.5s]", got)
+		}
+	}
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	for _, priority := range []TaskPriority{High, Medium, Low} {
+		if err := DefaultRetryPolicy(priority).Validate(); err != nil {
+			t.Fatalf("Default policy for %s is invalid: %v", priority, err)
+		}
+	}
+
+	invalid := []RetryPolicy{
+		{MaxAttempts: 0, Multiplier: 1},
+		{MaxAttempts: 1, Multiplier: 0.5},
+		{MaxAttempts: 1, Multiplier: 1, InitialBackoff: time.Minute, MaxBackoff: time.Second},
+		{MaxAttempts: 1, Multiplier: 1, Jitter: 2},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Fatalf("Expected %+v to be rejected", p)
+		}
+	}
+}
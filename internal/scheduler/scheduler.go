@@ -1,94 +1,154 @@
 package scheduler
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"sync"
 	"time"
 
 	"distributed-task-scheduler/pkg/models"
 	"distributed-task-scheduler/pkg/repositories"
+)
 
-	"github.com/google/uuid"
+var (
+	// ErrNotFound is returned when the requested record doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrInvalid wraps validation failures of client input
+	ErrInvalid = errors.New("invalid")
+	// ErrConflict is returned when a task's current state doesn't allow the operation
+	ErrConflict = errors.New("conflict")
+	// ErrQueueFull is returned when a submission doesn't fit in the queue; see SetQueueLimits
+	ErrQueueFull = errors.New("queue is full")
 )
 
 // TaskScheduler coordinates the queue + DB repo
 type TaskScheduler struct {
-	queue *PriorityQueue
+	queue Queue
 	repo  *repositories.TaskRepository
 
+	// cache holds tasks run by this node's workers; it stays empty when the
+	// queue is shared because other nodes' progress never shows up in it.
+	// cacheMutex also guards the fields of the cached tasks, which workers
+	// update while clients read them.
 	cache      map[string]*Task
 	cacheMutex sync.RWMutex
+
+	onCancel func(taskID string)
+
+	// nodeID names this node on the bulk operations it runs
+	nodeID string
+
+	// idempotencyWindow is how long an idempotency key maps to its task
+	idempotencyWindow time.Duration
+	maxBatchSize      int
+	queueLimits       QueueLimits
+
+	// waiters are clients long-polling for a task to finish
+	waiters      map[string][]chan struct{}
+	waitersMutex sync.Mutex
 }
 
 // NewTaskScheduler binds queue + repo
-func NewTaskScheduler(queue *PriorityQueue, repo *repositories.TaskRepository) *TaskScheduler {
+func NewTaskScheduler(queue Queue, repo *repositories.TaskRepository) *TaskScheduler {
 	return &TaskScheduler{
-		queue: queue,
-		repo:  repo,
-		cache: make(map[string]*Task),
+		queue:   queue,
+		repo:    repo,
+		cache:   make(map[string]*Task),
+		waiters: make(map[string][]chan struct{}),
+
+		idempotencyWindow: defaultIdempotencyWindow,
+		maxBatchSize:      defaultMaxBatchSize,
 	}
 }
 
-// SubmitTask persists + enqueues
-func (ts *TaskScheduler) SubmitTask(priority TaskPriority, payload interface{}) *Task {
-	// Create Task
-	task := &Task{
-		ID:        uuid.New().String(),
-		Priority:  priority,
-		Payload:   payload,
-		CreatedAt: time.Now().UTC(),
-		Status:    "pending",
+// TaskSpec describes a task to be submitted
+type TaskSpec struct {
+	ID       string // optional; a random UUID is used when empty
+	Type     string
+	Priority TaskPriority
+	Payload  interface{}
+	Labels   map[string]string
+	Retry    *RetryPolicy  // nil means DefaultRetryPolicy(Priority)
+	Timeout  time.Duration // zero means DefaultTimeout(Priority)
+	RunAt    *time.Time    // nil or past means run as soon as possible
+}
+
+// newTask creates the pending task a spec describes
+func (spec TaskSpec) newTask() *Task {
+	task := NewTask(spec.Type, spec.Priority, spec.Payload)
+	task.Labels = spec.Labels
+	if spec.ID != "" {
+		task.ID = spec.ID
+	}
+	if spec.Retry != nil {
+		task.Retry = *spec.Retry
+	}
+	if spec.Timeout > 0 {
+		task.Timeout = spec.Timeout
 	}
+	if spec.RunAt != nil {
+		runAt := spec.RunAt.UTC()
+		task.RunAt = &runAt
+	}
+	return task
+}
 
-	// Persist to DB
-	dbTask := &models.Task{
-		ID:        task.ID,
-		Priority:  models.TaskPriority(priority),
-		Payload:   payload,
-		CreatedAt: task.CreatedAt,
-		Status:    task.Status,
+// SubmitTask persists + enqueues. Nothing is enqueued if the task can't be
+// stored, and nothing is stored if the queue is full.
+func (ts *TaskScheduler) SubmitTask(spec TaskSpec) (*Task, error) {
+	// Create Task
+	task := spec.newTask()
+	if err := ts.admit(task); err != nil {
+		return nil, err
 	}
 
-	if err := ts.repo.Create(dbTask); err != nil {
+	// Persist to DB
+	if err := ts.repo.Create(ts.newRow(task)); err != nil {
 		log.Printf("[Scheduler] DB insert failed: %v", err)
+		return nil, err
 	}
 
 	// Save to cache
-	ts.cacheMutex.Lock()
-	ts.cache[task.ID] = task
-	ts.cacheMutex.Unlock()
+	ts.remember(task)
+	created := ts.snapshot(task)
 
 	// Enqueue
 	ts.queue.PushTask(task)
 
-	log.Printf("[Scheduler] Submitted task %s with %s priority", task.ID, priority.String())
-	return task
+	if created.RunAt != nil {
+		log.Printf("[Scheduler] Submitted %s task %s with %s priority to run at %s", created.Type, created.ID, created.Priority.String(), created.RunAt.Format(time.RFC3339))
+	} else {
+		log.Printf("[Scheduler] Submitted %s task %s with %s priority", created.Type, created.ID, created.Priority.String())
+	}
+	return created, nil
 }
 
-// GetTask gets from cache or DB fallback
+// GetTask gets from cache or DB fallback. It returns a copy that stays
+// unchanged while workers go on with the task.
 func (ts *TaskScheduler) GetTask(id string) (*Task, bool) {
-	ts.cacheMutex.RLock()
-	if task, ok := ts.cache[id]; ok {
-		ts.cacheMutex.RUnlock()
+	task, ok := ts.lookup(id)
+	if !ok {
+		return nil, false
+	}
+	return ts.snapshot(task), true
+}
+
+// lookup returns the task shared with the queue and workers, from cache or
+// DB fallback. Its fields may only be changed through update.
+func (ts *TaskScheduler) lookup(id string) (*Task, bool) {
+	if task, ok := ts.cached(id); ok {
 		return task, true
 	}
-	ts.cacheMutex.RUnlock()
 
 	// Fallback: try DB
 	dbTask, err := ts.repo.GetByID(id)
 	if err == nil && dbTask != nil {
-		task := &Task{
-			ID:        dbTask.ID,
-			Priority:  TaskPriority(dbTask.Priority),
-			Payload:   dbTask.Payload,
-			CreatedAt: dbTask.CreatedAt,
-			Status:    dbTask.Status,
-		}
+		task := taskFromModel(dbTask)
 
 		// Re-cache
-		ts.cacheMutex.Lock()
-		ts.cache[id] = task
-		ts.cacheMutex.Unlock()
+		ts.remember(task)
 
 		return task, true
 	}
@@ -96,67 +156,238 @@ func (ts *TaskScheduler) GetTask(id string) (*Task, bool) {
 	return nil, false
 }
 
-// RecoverUnfinishedTasks reloads from DB on startup
-func (ts *TaskScheduler) RecoverUnfinishedTasks() {
-	tasks, err := ts.repo.GetUnfinishedTasks()
-	if err != nil {
-		log.Printf("[Scheduler] Failed recovery query: %v", err)
+// snapshot copies a task under the cache lock
+func (ts *TaskScheduler) snapshot(task *Task) *Task {
+	ts.cacheMutex.RLock()
+	defer ts.cacheMutex.RUnlock()
+	c := *task
+	c.History = append(models.AttemptHistory(nil), task.History...)
+	return &c
+}
+
+// update changes the fields of a task that may be cached under the cache lock
+func (ts *TaskScheduler) update(task *Task, fn func(task *Task)) {
+	ts.cacheMutex.Lock()
+	defer ts.cacheMutex.Unlock()
+	fn(task)
+}
+
+// TaskLock is the lock workers hold while they change a task, so that copies
+// handed out by GetTask are consistent
+func (ts *TaskScheduler) TaskLock() sync.Locker {
+	return &ts.cacheMutex
+}
+
+// forget drops a task from the cache
+func (ts *TaskScheduler) forget(id string) {
+	ts.cacheMutex.Lock()
+	delete(ts.cache, id)
+	ts.cacheMutex.Unlock()
+}
+
+// cached returns the cached copy of a task, if any
+func (ts *TaskScheduler) cached(id string) (*Task, bool) {
+	ts.cacheMutex.RLock()
+	defer ts.cacheMutex.RUnlock()
+	task, ok := ts.cache[id]
+	return task, ok
+}
+
+// remember caches a task unless the queue is shared with other nodes
+func (ts *TaskScheduler) remember(task *Task) {
+	if ts.queue.Shared() {
 		return
 	}
+	ts.cacheMutex.Lock()
+	ts.cache[task.ID] = task
+	ts.cacheMutex.Unlock()
+}
+
+// RecoverUnfinishedTasks reloads from DB on startup. Tasks whose run_at is
+// still in the future go back to waiting for it. Tasks running on other nodes
+// are left to them; if such a node died the leader reclaims its tasks.
+func (ts *TaskScheduler) RecoverUnfinishedTasks(nodeID string) {
+	defer ts.refreshDeadLetterGauge()
 
-	for _, dbTask := range tasks {
-		task := &Task{
-			ID:        dbTask.ID,
-			Priority:  TaskPriority(dbTask.Priority),
-			Payload:   dbTask.Payload,
-			CreatedAt: dbTask.CreatedAt,
-			Status:    dbTask.Status,
+	// Bulk operations don't survive a restart; their actions are safe to submit again
+	if n, err := ts.repo.AbandonOperations(nodeID, "interrupted by a restart of node "+nodeID); err != nil {
+		log.Printf("[Scheduler] Failed to abandon operations of node %s: %v", nodeID, err)
+	} else if n > 0 {
+		log.Printf("[Scheduler] Abandoned %d operations interrupted by the restart", n)
+	}
+
+	if ts.queue.Shared() {
+		// Pending rows already are the queue; only free what this node left running
+		if err := ts.repo.ReleaseOwnedTasks(nodeID, errTaskCancelled.Error()); err != nil {
+			log.Printf("[Scheduler] Failed to release tasks of node %s: %v", nodeID, err)
 		}
+		return
+	}
 
-		ts.cacheMutex.Lock()
-		ts.cache[task.ID] = task
-		ts.cacheMutex.Unlock()
+	tasks, err := ts.repo.GetRecoverableTasks(nodeID)
+	if err != nil {
+		log.Printf("[Scheduler] Failed recovery query: %v", err)
+		return
+	}
 
+	for i := range tasks {
+		task := taskFromModel(&tasks[i])
+		ts.remember(task)
 		ts.queue.PushTask(task)
 	}
 
 	log.Printf("[Scheduler] Recovered %d unfinished tasks", len(tasks))
 }
 
-// GetAllTasks returns all tasks from cache and DB fallback.
-func (ts *TaskScheduler) GetAllTasks() []*Task {
-	// get all from cache
-	ts.cacheMutex.RLock()
-	cacheTasks := make(map[string]*Task, len(ts.cache))
-	for id, t := range ts.cache {
-		cacheTasks[id] = t
+// TaskList is a page of tasks
+type TaskList struct {
+	Tasks      []*Task `json:"tasks"`
+	NextCursor string  `json:"next_cursor,omitempty"` // pass as cursor to get the next page
+	Total      *int64  `json:"total,omitempty"`       // tasks matching the filter across all pages
+}
+
+// ListTasks returns a page of the tasks matching the query, read from the DB
+func (ts *TaskScheduler) ListTasks(q repositories.TaskQuery) (*TaskList, error) {
+	page, err := ts.repo.ListTasks(q)
+	if errors.Is(err, repositories.ErrInvalidCursor) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
 	}
-	ts.cacheMutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	list := &TaskList{
+		Tasks:      make([]*Task, len(page.Tasks)),
+		NextCursor: page.NextCursor,
+		Total:      page.Total,
+	}
+	for i := range page.Tasks {
+		list.Tasks[i] = taskFromModel(&page.Tasks[i])
+	}
+	return list, nil
+}
 
-	// get all tasks from DB
-	dbTasks, err := ts.repo.GetAll()
+// DeleteTasks removes the finished tasks matching the filter, with their
+// dead-letter entries, and returns how many were removed. Unfinished tasks
+// have to be cancelled first.
+func (ts *TaskScheduler) DeleteTasks(filter repositories.TaskFilter) (int, error) {
+	ids, dropped, err := ts.repo.DeleteTasks(filter)
 	if err != nil {
-		log.Printf("[Scheduler] Failed to get tasks from DB: %v", err)
+		return 0, err
 	}
+	if dropped > 0 {
+		ts.refreshDeadLetterGauge()
+	}
+	for _, id := range ids {
+		ts.forget(id)
+	}
+	log.Printf("[Scheduler] Deleted %d tasks", len(ids))
+	return len(ids), nil
+}
 
-	// Combine: avoid duplicates by checking IDs
-	allTasks := make([]*Task, 0, len(cacheTasks)+len(dbTasks))
-	for _, t := range cacheTasks {
-		allTasks = append(allTasks, t)
+// newRow is the row to store for a new task: pending tasks are held by this
+// node until a worker picks them up, unless the queue is shared
+func (ts *TaskScheduler) newRow(task *Task) *models.Task {
+	row := task.toModel()
+	if task.Status == models.StatusPending {
+		row.OwnerNode = ts.holder()
 	}
+	return row
+}
 
-	for _, dbTask := range dbTasks {
-		if _, exists := cacheTasks[dbTask.ID]; !exists {
-			t := &Task{
-				ID:        dbTask.ID,
-				Priority:  TaskPriority(dbTask.Priority),
-				Payload:   dbTask.Payload,
-				CreatedAt: dbTask.CreatedAt,
-				Status:    dbTask.Status,
-			}
-			allTasks = append(allTasks, t)
-		}
+// holder is the node that keeps the tasks this node enqueues in memory; empty
+// when the queue is shared and pending rows belong to no node
+func (ts *TaskScheduler) holder() string {
+	if ts.queue.Shared() {
+		return ""
+	}
+	return ts.nodeID
+}
+
+// toModel converts a Task into its persisted form
+func (t *Task) toModel() *models.Task {
+	return &models.Task{
+		ID:        t.ID,
+		Type:      t.Type,
+		Priority:  models.TaskPriority(t.Priority),
+		Payload:   t.Payload,
+		CreatedAt: t.CreatedAt,
+		Status:    t.Status,
+		Labels:    t.Labels,
+		Result:    t.Result,
+		Error:     t.Error,
+		Attempts:  t.Attempts,
+		History:   t.History,
+		RunAt:     t.RunAt,
+		Timeout:   t.Timeout,
+
+		StartedAt:  t.StartedAt,
+		FinishedAt: t.FinishedAt,
+
+		WorkflowID:      t.WorkflowID,
+		WorkflowKey:     t.WorkflowKey,
+		CancelRequested: t.CancelRequested,
+		Retry: models.RetryPolicy{
+			MaxAttempts:    t.Retry.MaxAttempts,
+			InitialBackoff: t.Retry.InitialBackoff,
+			Multiplier:     t.Retry.Multiplier,
+			MaxBackoff:     t.Retry.MaxBackoff,
+			Jitter:         t.Retry.Jitter,
+		},
+	}
+}
+
+// taskFromModel converts a persisted task back into a Task
+func taskFromModel(dbTask *models.Task) *Task {
+	task := &Task{
+		ID:        dbTask.ID,
+		Type:      dbTask.Type,
+		Priority:  TaskPriority(dbTask.Priority),
+		Payload:   decodeJSON(dbTask.Payload),
+		CreatedAt: dbTask.CreatedAt,
+		Status:    dbTask.Status,
+		Labels:    dbTask.Labels,
+		Result:    decodeJSON(dbTask.Result),
+		Error:     dbTask.Error,
+		Attempts:  dbTask.Attempts,
+		History:   dbTask.History,
+		RunAt:     dbTask.RunAt,
+		Timeout:   dbTask.Timeout,
+
+		StartedAt:  dbTask.StartedAt,
+		FinishedAt: dbTask.FinishedAt,
+
+		WorkflowID:      dbTask.WorkflowID,
+		WorkflowKey:     dbTask.WorkflowKey,
+		CancelRequested: dbTask.CancelRequested,
+		Retry: RetryPolicy{
+			MaxAttempts:    dbTask.Retry.MaxAttempts,
+			InitialBackoff: dbTask.Retry.InitialBackoff,
+			Multiplier:     dbTask.Retry.Multiplier,
+			MaxBackoff:     dbTask.Retry.MaxBackoff,
+			Jitter:         dbTask.Retry.Jitter,
+		},
+	}
+	// Rows written before retry policies existed
+	if task.Retry.MaxAttempts == 0 {
+		task.Retry = DefaultRetryPolicy(task.Priority)
 	}
+	if task.Timeout == 0 {
+		task.Timeout = DefaultTimeout(task.Priority)
+	}
+	return task
+}
 
-	return allTasks
+// decodeJSON turns jsonb columns, which the driver hands back as raw bytes,
+// into plain Go values
+func decodeJSON(v interface{}) interface{} {
+	raw, ok := v.([]byte)
+	if !ok {
+		return v
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return string(raw)
+	}
+	return decoded
 }
@@ -0,0 +1,27 @@
+package scheduler
+
+import (
+	"errors"
+	"time"
+)
+
+// errTaskTimedOut is the cancellation cause of a handler that ran past its timeout
+var errTaskTimedOut = errors.New("task timed out")
+
+var defaultTimeouts = map[TaskPriority]time.Duration{
+	High:   time.Minute,
+	Medium: 5 * time.Minute,
+	Low:    15 * time.Minute,
+}
+
+// DefaultTimeout returns how long a task may run when its submission doesn't
+// say; priorities between the named levels use their level's timeout
+func DefaultTimeout(priority TaskPriority) time.Duration {
+	return defaultTimeouts[priority.Level()]
+}
+
+// SetDefaultTimeout overrides the default timeout of the level a priority
+// belongs to. It must be called before tasks are submitted or recovered.
+func SetDefaultTimeout(priority TaskPriority, timeout time.Duration) {
+	defaultTimeouts[priority.Level()] = timeout
+}
@@ -0,0 +1,22 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetDefaultTimeoutAppliesToLevel(t *testing.T) {
+	saved := DefaultTimeout(High)
+	defer SetDefaultTimeout(High, saved)
+
+	// 250 is in the High level, so it sets High's default
+	SetDefaultTimeout(250, 42*time.Second)
+	for _, p := range []TaskPriority{High, 250, 0} {
+		if got := DefaultTimeout(p); got != 42*time.Second {
+			t.Fatalf("Expected priority %s to default to 42s, got %s", p, got)
+		}
+	}
+	if got := DefaultTimeout(Medium); got == 42*time.Second {
+		t.Fatalf("Expected Medium's default to be untouched")
+	}
+}
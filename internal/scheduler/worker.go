@@ -2,36 +2,94 @@ package scheduler
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"distributed-task-scheduler/internal/metrics"
+	"distributed-task-scheduler/pkg/models"
 	"distributed-task-scheduler/pkg/repositories"
+
+	"github.com/google/uuid"
 )
 
+// taskLease is how long a node's claim on a running task lasts without
+// renewal; running tasks renew it every taskLease/3.
+const taskLease = 30 * time.Second
+
+const defaultDrainTimeout = 10 * time.Second
+
+// taskStore is the part of the task repository workers use
+type taskStore interface {
+	StartAttempt(id string, attempts int, owner string, lease time.Duration) (bool, error)
+	GetByID(id string) (*models.Task, error)
+	RenewLease(id string, owner string, lease time.Duration) (held bool, cancelRequested bool, err error)
+	ScheduleRetry(id string, errMsg string, history models.AttemptHistory, runAt time.Time, holder string) (bool, error)
+	ReleaseAttempt(id string, owner string, attempts int, holder string, cancelMsg string) (bool, error)
+	SaveResult(id string, status string, result interface{}, errMsg string, history models.AttemptHistory) error
+	MoveToDeadLetter(dl *models.DeadLetter, status string) error
+}
+
+var _ taskStore = (*repositories.TaskRepository)(nil)
+
 // WorkerPool runs N workers.
 type WorkerPool struct {
-	queue     *PriorityQueue
-	repo      *repositories.TaskRepository
+	queue     Queue
+	repo      taskStore
+	registry  *HandlerRegistry
+	nodeID    string
 	workerNum int
+	running   atomic.Int64
 	wg        sync.WaitGroup
-	ctx       context.Context
-	cancel    context.CancelFunc
+
+	onFinish func(task *Task)
+
+	// taskLock is held while a task's fields change; see SetTaskLock
+	taskLock sync.Locker
+
+	// active holds the cancel functions of the tasks running on this node
+	active     map[string]context.CancelCauseFunc
+	activeLock sync.Mutex
+
+	// ctx stops workers from taking new tasks; taskCtx is the parent of the
+	// running tasks' contexts and is only cancelled once draining gives up
+	ctx          context.Context
+	cancel       context.CancelFunc
+	taskCtx      context.Context
+	cancelTasks  context.CancelFunc
+	drainTimeout time.Duration
 }
 
-// NewWorkerPool with repo for DB updates.
-func NewWorkerPool(queue *PriorityQueue, repo *repositories.TaskRepository, workerNum int) *WorkerPool {
+// NewWorkerPool with repo for DB updates and registry to resolve task handlers.
+// Tasks are claimed in the DB under nodeID while they run.
+func NewWorkerPool(queue Queue, repo *repositories.TaskRepository, registry *HandlerRegistry, nodeID string, workerNum int) *WorkerPool {
 	ctx, cancel := context.WithCancel(context.Background())
+	taskCtx, cancelTasks := context.WithCancel(context.Background())
 	return &WorkerPool{
-		queue:     queue,
-		repo:      repo,
-		workerNum: workerNum,
-		ctx:       ctx,
-		cancel:    cancel,
+		queue:        queue,
+		repo:         repo,
+		registry:     registry,
+		nodeID:       nodeID,
+		workerNum:    workerNum,
+		active:       make(map[string]context.CancelCauseFunc),
+		ctx:          ctx,
+		cancel:       cancel,
+		taskCtx:      taskCtx,
+		cancelTasks:  cancelTasks,
+		drainTimeout: defaultDrainTimeout,
+		taskLock:     &sync.Mutex{},
 	}
 }
 
+// SetDrainTimeout sets how long Stop lets running tasks finish before it
+// interrupts them
+func (wp *WorkerPool) SetDrainTimeout(d time.Duration) {
+	wp.drainTimeout = d
+}
+
 func (wp *WorkerPool) Start() {
 	for i := 0; i < wp.workerNum; i++ {
 		wp.wg.Add(1)
@@ -40,53 +98,354 @@ func (wp *WorkerPool) Start() {
 	log.Printf("[WorkerPool] Started %d workers", wp.workerNum)
 }
 
+// Stop makes the workers take no more tasks, which wakes idle workers waiting
+// in PopTask, and lets running tasks finish for up to the drain timeout.
+// Tasks still running then are interrupted and go back to pending without
+// counting the attempt. Stop returns once every worker has exited.
 func (wp *WorkerPool) Stop() {
 	log.Println("[WorkerPool] Stopping...")
 	wp.cancel()
-	wp.wg.Wait()
+	defer wp.cancelTasks()
+
+	done := make(chan struct{})
+	go func() {
+		wp.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(wp.drainTimeout):
+		log.Printf("[WorkerPool] %d tasks still running after %s, interrupting them", wp.running.Load(), wp.drainTimeout)
+		wp.cancelTasks()
+		<-done
+	}
 	log.Println("[WorkerPool] All workers stopped.")
 }
 
+// SetTaskLock makes workers hold lock while they change a task, so that
+// readers holding it too, like the scheduler's GetTask, see consistent tasks
+func (wp *WorkerPool) SetTaskLock(lock sync.Locker) {
+	wp.taskLock = lock
+}
+
+// update changes a task's fields under the task lock
+func (wp *WorkerPool) update(task *Task, fn func(task *Task)) {
+	wp.taskLock.Lock()
+	defer wp.taskLock.Unlock()
+	fn(task)
+}
+
+// Stats reports the number of workers and how many of them are executing a task
+func (wp *WorkerPool) Stats() (workers, running int) {
+	return wp.workerNum, int(wp.running.Load())
+}
+
+// OnFinish registers fn to be called whenever a task reaches a final status
+func (wp *WorkerPool) OnFinish(fn func(task *Task)) {
+	wp.onFinish = fn
+}
+
+// finished reports a task that reached a final status
+func (wp *WorkerPool) finished(task *Task) {
+	finishedAt := time.Now().UTC()
+	wp.update(task, func(task *Task) { task.FinishedAt = &finishedAt })
+	if wp.onFinish != nil {
+		wp.onFinish(task)
+	}
+}
+
+// CancelRunning aborts the handler of a task running on this node. It is a
+// no-op for tasks that aren't running here.
+func (wp *WorkerPool) CancelRunning(taskID string) {
+	wp.activeLock.Lock()
+	defer wp.activeLock.Unlock()
+	if cancel, ok := wp.active[taskID]; ok {
+		cancel(errTaskCancelled)
+	}
+}
+
 func (wp *WorkerPool) worker(id int) {
 	defer wp.wg.Done()
 	for {
-		select {
-		case <-wp.ctx.Done():
+		// nil means the pool is stopping or the queue was closed
+		task := wp.queue.PopTask(wp.ctx)
+		if task == nil {
 			log.Printf("[Worker %d] Shutting down", id)
 			return
-		default:
-			task := wp.queue.PopTask()
-			if task == nil {
-				time.Sleep(100 * time.Millisecond)
-				continue
-			}
-			wp.processTask(id, task)
 		}
+		wp.running.Add(1)
+		wp.processTask(id, task)
+		wp.running.Add(-1)
 	}
 }
 
 func (wp *WorkerPool) processTask(workerID int, task *Task) {
-	log.Printf("[Worker %d] Processing task %s (Priority: %s)", workerID, task.ID, task.Priority.String())
+	log.Printf("[Worker %d] Processing %s task %s (Priority: %s)", workerID, task.Type, task.ID, task.Priority.String())
 
 	start := time.Now()
 
 	// Mark as running
-	task.Status = "running"
-	if err := wp.repo.UpdateStatus(task.ID, task.Status); err != nil {
+	startedAt := start.UTC()
+	wp.update(task, func(task *Task) {
+		task.Status = models.StatusRunning
+		task.StartedAt = &startedAt
+		task.Attempts++
+	})
+	started, err := wp.repo.StartAttempt(task.ID, task.Attempts, wp.nodeID, taskLease)
+	if err != nil {
 		log.Printf("[Worker %d] Failed DB update: %v", workerID, err)
+	} else if !started {
+		wp.update(task, func(task *Task) { task.Attempts-- })
+		wp.skipUnstarted(workerID, task)
+		return
 	}
 
-	time.Sleep(2 * time.Second) // Simulated work
+	taskCtx, cancel := context.WithCancelCause(wp.taskCtx)
+	wp.activeLock.Lock()
+	wp.active[task.ID] = cancel
+	wp.activeLock.Unlock()
 
-	// Mark as completed
-	task.Status = "completed"
-	if err := wp.repo.UpdateStatus(task.ID, task.Status); err != nil {
-		log.Printf("[Worker %d] Failed DB update: %v", workerID, err)
+	leaseLost := wp.holdLease(taskCtx, cancel, task.ID)
+	execCtx, stopTimer := context.WithTimeoutCause(taskCtx, task.Timeout, errTaskTimedOut)
+	result, err := wp.execute(execCtx, task)
+	cancelled := errors.Is(context.Cause(taskCtx), errTaskCancelled)
+	timedOut := !cancelled && errors.Is(context.Cause(execCtx), errTaskTimedOut)
+	stopTimer()
+	cancel(nil)
+
+	wp.activeLock.Lock()
+	delete(wp.active, task.ID)
+	wp.activeLock.Unlock()
+
+	if leaseLost() {
+		// The task was reclaimed and may already run elsewhere; its row is no longer ours to update
+		log.Printf("[Worker %d] Lost lease on task %s, discarding attempt %d", workerID, task.ID, task.Attempts)
+		return
+	}
+	if err != nil && !cancelled && wp.taskCtx.Err() != nil {
+		// Interrupted by Stop: a restart is no failure of the task
+		wp.releaseAttempt(workerID, task)
+		return
+	}
+
+	record := models.AttemptRecord{Attempt: task.Attempts, StartedAt: start.UTC(), FinishedAt: time.Now().UTC()}
+	switch {
+	case cancelled:
+		err = errTaskCancelled
+	case timedOut:
+		err = fmt.Errorf("%w after %s", errTaskTimedOut, task.Timeout)
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	wp.update(task, func(task *Task) { task.History = append(task.History, record) })
+
+	// Record the outcome
+	switch {
+	case cancelled:
+		log.Printf("[Worker %d] Task %s cancelled during attempt %d", workerID, task.ID, task.Attempts)
+		wp.finishCancelled(workerID, task)
+	case err == nil:
+		wp.update(task, func(task *Task) {
+			task.Status = models.StatusCompleted
+			task.Result = result
+			task.Error = ""
+		})
+		if err := wp.repo.SaveResult(task.ID, task.Status, task.Result, task.Error, task.History); err != nil {
+			log.Printf("[Worker %d] Failed DB update: %v", workerID, err)
+		}
+		wp.finished(task)
+	case task.Attempts < task.Retry.MaxAttempts && !errors.Is(err, errNoHandler):
+		backoff := task.Retry.Backoff(task.Attempts)
+		runAt := time.Now().UTC().Add(backoff)
+		wp.update(task, func(task *Task) { task.Error = err.Error() })
+		retried, dbErr := wp.repo.ScheduleRetry(task.ID, task.Error, task.History, runAt, wp.holder())
+		if dbErr != nil {
+			log.Printf("[Worker %d] Failed DB update: %v", workerID, dbErr)
+		} else if !retried {
+			// Cancelled while the attempt was failing; a retry would never start
+			log.Printf("[Worker %d] Task %s cancelled during attempt %d", workerID, task.ID, task.Attempts)
+			wp.finishCancelled(workerID, task)
+			break
+		}
+		wp.update(task, func(task *Task) {
+			task.Status = models.StatusPending
+			task.RunAt = &runAt
+		})
+		log.Printf("[Worker %d] Task %s attempt %d/%d failed: %v (retrying in %s)",
+			workerID, task.ID, task.Attempts, task.Retry.MaxAttempts, err, backoff)
+		wp.queue.PushTask(task)
+	default:
+		wp.update(task, func(task *Task) {
+			task.Status = models.StatusFailed
+			if timedOut {
+				task.Status = models.StatusTimedOut
+			}
+			task.Error = err.Error()
+		})
+		log.Printf("[Worker %d] Task %s failed after %d attempts: %v", workerID, task.ID, task.Attempts, err)
+		wp.deadLetter(workerID, task)
+		wp.finished(task)
 	}
 
 	duration := time.Since(start).Seconds()
-	metrics.TaskDuration.WithLabelValues(task.Priority.String()).Observe(duration)
-	metrics.TasksProcessed.WithLabelValues(task.Status).Inc()
+	metrics.TaskDuration.WithLabelValues(task.Priority.Level().String()).Observe(duration)
+	switch {
+	case timedOut:
+		// Counted once per timed-out attempt, whether or not it is retried
+		metrics.TaskProcessed(models.StatusTimedOut, task.Labels)
+	case task.Status == models.StatusPending:
+		metrics.TaskProcessed("retried", task.Labels)
+	default:
+		metrics.TaskProcessed(task.Status, task.Labels)
+	}
+
+	log.Printf("[Worker %d] Finished attempt %d of task %s as %s in %.2fs", workerID, task.Attempts, task.ID, task.Status, duration)
+}
+
+// execute runs the task's handler but returns as soon as ctx is done, so a
+// handler that ignores its context can't hold the worker beyond the task's
+// timeout. Such a handler keeps running in the background until it returns.
+func (wp *WorkerPool) execute(ctx context.Context, task *Task) (interface{}, error) {
+	type outcome struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := wp.registry.Execute(ctx, task.Type, task.Payload)
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case out := <-done:
+		return out.result, out.err
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
+
+// holdLease renews this node's lease on a running task until ctx is done.
+// If the lease turns out to be gone, or the task is to be cancelled, cancel
+// is called to abort the handler. The returned function waits for renewal to
+// stop and reports whether the lease was lost.
+func (wp *WorkerPool) holdLease(ctx context.Context, cancel context.CancelCauseFunc, taskID string) func() bool {
+	var lost atomic.Bool
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(taskLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				held, cancelRequested, err := wp.repo.RenewLease(taskID, wp.nodeID, taskLease)
+				if err != nil {
+					log.Printf("[WorkerPool] Failed to renew lease on task %s: %v", taskID, err)
+					continue
+				}
+				if !held {
+					lost.Store(true)
+					cancel(nil)
+					return
+				}
+				if cancelRequested {
+					cancel(errTaskCancelled)
+				}
+			}
+		}
+	}()
+	return func() bool {
+		<-done
+		return lost.Load()
+	}
+}
 
-	log.Printf("[Worker %d] Completed task %s in %.2fs", workerID, task.ID, duration)
+// releaseAttempt puts a task interrupted by the pool stopping back to pending
+// without counting the attempt, unless it was asked to be cancelled, in which
+// case it ends cancelled. It isn't requeued here: the node recovers it when it
+// starts again, or the leader does if the node is gone for good.
+func (wp *WorkerPool) releaseAttempt(workerID int, task *Task) {
+	cancelled, err := wp.repo.ReleaseAttempt(task.ID, wp.nodeID, task.Attempts-1, wp.holder(), errTaskCancelled.Error())
+	if err != nil {
+		log.Printf("[Worker %d] Failed DB update: %v", workerID, err)
+	}
+	if cancelled {
+		log.Printf("[Worker %d] Task %s interrupted by shutdown while being cancelled", workerID, task.ID)
+		wp.update(task, func(task *Task) {
+			task.Status = models.StatusCancelled
+			task.Error = errTaskCancelled.Error()
+			task.Result = nil
+		})
+		wp.finished(task)
+		return
+	}
+	wp.update(task, func(task *Task) {
+		task.Attempts--
+		task.Status = models.StatusPending
+		task.StartedAt = nil
+	})
+	log.Printf("[Worker %d] Task %s interrupted by shutdown, back to pending", workerID, task.ID)
+}
+
+// skipUnstarted drops a task whose attempt couldn't start: it was either
+// cancelled meanwhile or is already running on another node. A task that was
+// asked to be cancelled after this node claimed it, but before it started, is
+// finished as cancelled here since no one else will.
+func (wp *WorkerPool) skipUnstarted(workerID int, task *Task) {
+	current, err := wp.repo.GetByID(task.ID)
+	if err != nil {
+		log.Printf("[Worker %d] Failed to load task %s: %v", workerID, task.ID, err)
+		return
+	}
+	stuck := current.CancelRequested && (current.Status == models.StatusPending || current.OwnerNode == wp.nodeID)
+	if current.Status == models.StatusCancelled || stuck {
+		log.Printf("[Worker %d] Task %s was cancelled before it started", workerID, task.ID)
+		wp.finishCancelled(workerID, task)
+		return
+	}
+	log.Printf("[Worker %d] Task %s is %s on node %s, not starting it here", workerID, task.ID, current.Status, current.OwnerNode)
+	wp.update(task, func(task *Task) { task.Status = current.Status })
+}
+
+// holder is the node that keeps retried tasks in memory; empty when the
+// queue is shared
+func (wp *WorkerPool) holder() string {
+	if wp.queue.Shared() {
+		return ""
+	}
+	return wp.nodeID
+}
+
+// finishCancelled records that a task ended because it was cancelled
+func (wp *WorkerPool) finishCancelled(workerID int, task *Task) {
+	wp.update(task, func(task *Task) {
+		task.Status = models.StatusCancelled
+		task.Error = errTaskCancelled.Error()
+		task.Result = nil
+	})
+	if err := wp.repo.SaveResult(task.ID, task.Status, nil, task.Error, task.History); err != nil {
+		log.Printf("[Worker %d] Failed DB update: %v", workerID, err)
+	}
+	wp.finished(task)
+}
+
+// deadLetter moves a task that exhausted its retries into the dead-letter store
+func (wp *WorkerPool) deadLetter(workerID int, task *Task) {
+	entry := &models.DeadLetter{
+		ID:         uuid.New().String(),
+		TaskID:     task.ID,
+		Type:       task.Type,
+		Priority:   models.TaskPriority(task.Priority),
+		Payload:    task.Payload,
+		Attempts:   task.Attempts,
+		FinalError: task.Error,
+		History:    task.History,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := wp.repo.MoveToDeadLetter(entry, task.Status); err != nil {
+		log.Printf("[Worker %d] Failed to dead-letter task %s: %v", workerID, task.ID, err)
+	}
 }
@@ -0,0 +1,265 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"distributed-task-scheduler/pkg/models"
+)
+
+// fakeStore records what workers write instead of talking to a database
+type fakeStore struct {
+	mu              sync.Mutex
+	calls           []string
+	released        map[string]int // attempts a released task was reset to
+	cancelRequested bool           // as if every task had been asked to be cancelled
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{released: make(map[string]int)}
+}
+
+func (s *fakeStore) record(call string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, call)
+}
+
+func (s *fakeStore) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+func (s *fakeStore) RequestCancel() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cancelRequested = true
+}
+
+func (s *fakeStore) flagged() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cancelRequested
+}
+
+func (s *fakeStore) StartAttempt(id string, attempts int, owner string, lease time.Duration) (bool, error) {
+	s.record("StartAttempt")
+	return !s.flagged(), nil
+}
+
+// GetByID returns the task as claimed by node-1
+func (s *fakeStore) GetByID(id string) (*models.Task, error) {
+	s.record("GetByID")
+	return &models.Task{ID: id, Status: models.StatusRunning, OwnerNode: "node-1", CancelRequested: s.flagged()}, nil
+}
+
+func (s *fakeStore) RenewLease(id string, owner string, lease time.Duration) (bool, bool, error) {
+	s.record("RenewLease")
+	return true, false, nil
+}
+
+func (s *fakeStore) ScheduleRetry(id string, errMsg string, history models.AttemptHistory, runAt time.Time, holder string) (bool, error) {
+	s.record("ScheduleRetry")
+	return !s.flagged(), nil
+}
+
+func (s *fakeStore) ReleaseAttempt(id string, owner string, attempts int, holder string, cancelMsg string) (bool, error) {
+	s.record("ReleaseAttempt")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancelRequested {
+		return true, nil
+	}
+	s.released[id] = attempts
+	return false, nil
+}
+
+func (s *fakeStore) SaveResult(id string, status string, result interface{}, errMsg string, history models.AttemptHistory) error {
+	s.record("SaveResult " + status)
+	return nil
+}
+
+func (s *fakeStore) MoveToDeadLetter(dl *models.DeadLetter, status string) error {
+	s.record("MoveToDeadLetter")
+	return nil
+}
+
+func TestExecuteStopsAtTimeout(t *testing.T) {
+	registry := NewHandlerRegistry()
+	release := make(chan struct{})
+	defer close(release)
+	registry.Register("stuck", func(ctx context.Context, payload interface{}) (interface{}, error) {
+		<-release // ignores ctx on purpose
+		return nil, nil
+	})
+	wp := &WorkerPool{registry: registry}
+
+	ctx, cancel := context.WithTimeoutCause(context.Background(), 50*time.Millisecond, errTaskTimedOut)
+	defer cancel()
+
+	start := time.Now()
+	_, err := wp.execute(ctx, NewTask("stuck", High, nil))
+	if !errors.Is(err, errTaskTimedOut) {
+		t.Fatalf("Expected a timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expected execute to give up at the timeout, took %s", elapsed)
+	}
+}
+
+func TestWorkerPoolStopReturnsWithIdleWorkers(t *testing.T) {
+	fq, err := NewFairQueue(DefaultFairWeights, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []Queue{NewPriorityQueue(), fq} {
+		wp := NewWorkerPool(q, nil, NewHandlerRegistry(), "node-1", 4)
+		wp.Start()
+		// Let the workers park in PopTask
+		time.Sleep(20 * time.Millisecond)
+
+		stopped := make(chan struct{})
+		go func() {
+			wp.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Fatalf("%T: Stop didn't return with idle workers", q)
+		}
+	}
+}
+
+func TestWorkerPoolStopReleasesRunningTask(t *testing.T) {
+	registry := NewHandlerRegistry()
+	running := make(chan struct{})
+	registry.Register("wait", func(ctx context.Context, payload interface{}) (interface{}, error) {
+		close(running)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	store := newFakeStore()
+	q := NewPriorityQueue()
+	wp := NewWorkerPool(q, nil, registry, "node-1", 1)
+	wp.repo = store
+	wp.SetDrainTimeout(20 * time.Millisecond)
+
+	// On its last attempt a failure would dead-letter the task
+	task := NewTask("wait", High, nil)
+	task.Retry.MaxAttempts = 1
+	q.PushTask(task)
+	wp.Start()
+	<-running
+	wp.Stop()
+
+	for _, call := range store.Calls() {
+		switch call {
+		case "ScheduleRetry", "MoveToDeadLetter", "SaveResult " + models.StatusFailed:
+			t.Fatalf("Stop failed the running task: %v", store.Calls())
+		}
+	}
+	attempts, ok := store.released[task.ID]
+	if !ok || attempts != 0 {
+		t.Fatalf("Expected the task released with no attempts counted, got %v (calls %v)", store.released, store.Calls())
+	}
+	if task.Status != models.StatusPending || task.Attempts != 0 {
+		t.Fatalf("Expected the task pending with no attempts, got %s with %d", task.Status, task.Attempts)
+	}
+}
+
+func TestWorkerPoolStopDrainsBusyWorkers(t *testing.T) {
+	registry := NewHandlerRegistry()
+	running := make(chan struct{})
+	registry.Register("short", func(ctx context.Context, payload interface{}) (interface{}, error) {
+		close(running)
+		select {
+		case <-time.After(50 * time.Millisecond):
+			return "done", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+	store := newFakeStore()
+	q := NewPriorityQueue()
+	wp := NewWorkerPool(q, nil, registry, "node-1", 4)
+	wp.repo = store
+	wp.SetDrainTimeout(time.Second)
+
+	task := NewTask("short", High, nil)
+	q.PushTask(task)
+	wp.Start()
+	<-running
+
+	start := time.Now()
+	wp.Stop()
+	if elapsed := time.Since(start); elapsed > wp.drainTimeout {
+		t.Fatalf("Expected Stop to return once the task finished, took %s", elapsed)
+	}
+	if task.Status != models.StatusCompleted || task.Result != "done" {
+		t.Fatalf("Expected the running task to finish before Stop returned, got %s (calls %v)", task.Status, store.Calls())
+	}
+}
+
+func TestWorkerPoolFailsUnknownTypeWithoutRetrying(t *testing.T) {
+	store := newFakeStore()
+	q := NewPriorityQueue()
+	wp := NewWorkerPool(q, nil, NewHandlerRegistry(), "node-1", 1)
+	wp.repo = store
+
+	task := NewTask("missing", High, nil)
+	task.Retry.MaxAttempts = 3
+	wp.processTask(0, task)
+
+	if task.Status != models.StatusFailed || task.Attempts != 1 {
+		t.Fatalf("Expected the task failed after one attempt, got %s after %d", task.Status, task.Attempts)
+	}
+	for _, call := range store.Calls() {
+		if call == "ScheduleRetry" {
+			t.Fatalf("Expected no retry for an unknown type, got %v", store.Calls())
+		}
+	}
+}
+
+func TestWorkerPoolCancelsInsteadOfRetrying(t *testing.T) {
+	store := newFakeStore()
+	registry := NewHandlerRegistry()
+	registry.Register("fails", func(ctx context.Context, payload interface{}) (interface{}, error) {
+		// Cancelled on another node before this node's lease renewal noticed
+		store.RequestCancel()
+		return nil, errors.New("boom")
+	})
+	q := NewPriorityQueue()
+	wp := NewWorkerPool(q, nil, registry, "node-1", 1)
+	wp.repo = store
+
+	task := NewTask("fails", High, nil)
+	task.Retry.MaxAttempts = 3
+	wp.processTask(0, task)
+
+	if task.Status != models.StatusCancelled {
+		t.Fatalf("Expected the task cancelled instead of retried, got %s (calls %v)", task.Status, store.Calls())
+	}
+	if total, _ := q.Depth(); total != 0 {
+		t.Fatalf("Expected the cancelled task not to be queued again, got %d queued", total)
+	}
+}
+
+func TestWorkerPoolCancelsClaimedTaskBeforeStart(t *testing.T) {
+	store := newFakeStore()
+	store.RequestCancel()
+	wp := NewWorkerPool(NewPriorityQueue(), nil, NewHandlerRegistry(), "node-1", 1)
+	wp.repo = store
+
+	// Claimed by this node, then cancelled before StartAttempt
+	task := NewTask("echo", High, nil)
+	wp.processTask(0, task)
+
+	if task.Status != models.StatusCancelled || task.Attempts != 0 {
+		t.Fatalf("Expected the task cancelled without an attempt, got %s after %d (calls %v)", task.Status, task.Attempts, store.Calls())
+	}
+}
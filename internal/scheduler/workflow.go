@@ -0,0 +1,387 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"distributed-task-scheduler/pkg/models"
+	"distributed-task-scheduler/pkg/repositories"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Overall states of a workflow
+const (
+	WorkflowRunning   = "running"   // some tasks haven't finished yet
+	WorkflowCompleted = "completed" // every task completed
+	WorkflowFailed    = "failed"    // every task finished, not all of them completed
+)
+
+// WorkflowSpec describes a set of tasks and the order they must run in
+type WorkflowSpec struct {
+	Name  string
+	Tasks []WorkflowTaskSpec
+}
+
+// WorkflowTaskSpec is one node of a workflow graph
+type WorkflowTaskSpec struct {
+	Key       string // names the task within the workflow
+	Task      TaskSpec
+	DependsOn []Dependency
+}
+
+// Dependency is an edge to a parent task, named by its key
+type Dependency struct {
+	Key       string `json:"key"`
+	OnFailure string `json:"on_failure"` // skip, fail or run; defaults to fail
+}
+
+// Workflow is a workflow graph with the state of each of its tasks
+type Workflow struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Status    string         `json:"status"`
+	CreatedAt time.Time      `json:"created_at"`
+	Tasks     []WorkflowNode `json:"tasks"`
+}
+
+// WorkflowNode is a task of a workflow together with its incoming edges
+type WorkflowNode struct {
+	Key       string       `json:"key"`
+	DependsOn []Dependency `json:"depends_on"`
+	Task      *Task        `json:"task"`
+}
+
+// SubmitWorkflow validates the graph and stores all of its tasks at once.
+// Tasks without dependencies are enqueued right away; the others stay
+// blocked until their parents have finished.
+func (ts *TaskScheduler) SubmitWorkflow(spec WorkflowSpec) (*Workflow, error) {
+	if err := validateWorkflow(spec); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	workflow := &models.Workflow{
+		ID:        uuid.New().String(),
+		Name:      spec.Name,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	byKey := make(map[string]*Task, len(spec.Tasks))
+	tasks := make([]*Task, 0, len(spec.Tasks))
+	rows := make([]*models.Task, 0, len(spec.Tasks))
+	for _, node := range spec.Tasks {
+		task := node.Task.newTask()
+		task.WorkflowID = workflow.ID
+		task.WorkflowKey = node.Key
+		if len(node.DependsOn) > 0 {
+			task.Status = models.StatusBlocked
+		}
+		byKey[node.Key] = task
+		tasks = append(tasks, task)
+		rows = append(rows, ts.newRow(task))
+	}
+	if err := ts.admit(tasks...); err != nil {
+		return nil, err
+	}
+
+	var deps []models.TaskDependency
+	for _, node := range spec.Tasks {
+		for _, dep := range node.DependsOn {
+			deps = append(deps, models.TaskDependency{
+				WorkflowID: workflow.ID,
+				ParentID:   byKey[dep.Key].ID,
+				ChildID:    byKey[node.Key].ID,
+				OnFailure:  onFailurePolicy(dep.OnFailure),
+			})
+		}
+	}
+
+	if err := ts.repo.CreateWorkflow(workflow, rows, deps); err != nil {
+		log.Printf("[Scheduler] DB insert of workflow failed: %v", err)
+		return nil, err
+	}
+
+	for _, task := range tasks {
+		ts.remember(task)
+		if task.Status == models.StatusPending {
+			ts.queue.PushTask(task)
+		}
+	}
+	log.Printf("[Scheduler] Submitted workflow %s (%q) with %d tasks and %d dependencies", workflow.ID, workflow.Name, len(tasks), len(deps))
+
+	return buildWorkflow(workflow, tasks, deps), nil
+}
+
+// GetWorkflow returns a workflow graph with the current status of every task
+func (ts *TaskScheduler) GetWorkflow(id string) (*Workflow, error) {
+	workflow, err := ts.repo.GetWorkflow(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows, err := ts.repo.WorkflowTasks(id)
+	if err != nil {
+		return nil, err
+	}
+	deps, err := ts.repo.WorkflowDependencies(id)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]*Task, len(rows))
+	for i := range rows {
+		tasks[i] = taskFromModel(&rows[i])
+	}
+	return buildWorkflow(workflow, tasks, deps), nil
+}
+
+// TaskFinished is called when a task reaches a final status. It wakes
+// clients waiting for the result; children of a workflow task that no longer
+// wait for anything are released or cascaded.
+func (ts *TaskScheduler) TaskFinished(task *Task) {
+	ts.notifyFinished(task.ID)
+	if task.WorkflowID != "" {
+		ts.releaseDependents(task.ID)
+	}
+}
+
+// ResolveBlockedTasks settles blocked tasks whose parents have all finished.
+// Normally that happens as each parent finishes; this catches up on parents
+// whose node died in between. It returns how many tasks were looked at.
+func (ts *TaskScheduler) ResolveBlockedTasks() (int, error) {
+	ids, err := ts.repo.ResolvableBlockedTaskIDs()
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		ts.resolveBlocked(id)
+	}
+	return len(ids), nil
+}
+
+// releaseDependents re-evaluates the children of a finished task
+func (ts *TaskScheduler) releaseDependents(parentID string) {
+	children, err := ts.repo.DependentTaskIDs(parentID)
+	if err != nil {
+		log.Printf("[Scheduler] Failed to load dependents of task %s: %v", parentID, err)
+		return
+	}
+	for _, id := range children {
+		ts.resolveBlocked(id)
+	}
+}
+
+// resolveBlocked enqueues, skips or fails a blocked task once all of its
+// parents have finished. Skipped and failed tasks cascade to their own children.
+func (ts *TaskScheduler) resolveBlocked(id string) {
+	parents, err := ts.repo.ParentStates(id)
+	if err != nil {
+		log.Printf("[Scheduler] Failed to load dependencies of task %s: %v", id, err)
+		return
+	}
+	status, errMsg, ready := dependencyOutcome(parents)
+	if !ready {
+		return
+	}
+
+	// Parents finishing at the same time on different nodes may both get
+	// here; only the one that flips the row goes on
+	resolved, err := ts.repo.ResolveBlockedTask(id, status, errMsg, ts.holder())
+	if err != nil {
+		log.Printf("[Scheduler] Failed to resolve task %s: %v", id, err)
+		return
+	}
+	if !resolved {
+		return
+	}
+
+	task, ok := ts.lookup(id)
+	if ok {
+		ts.update(task, func(task *Task) {
+			task.Status = status
+			task.Error = errMsg
+		})
+	}
+	if status == models.StatusPending {
+		if !ok {
+			log.Printf("[Scheduler] Released task %s has vanished", id)
+			return
+		}
+		ts.queue.PushTask(task)
+		log.Printf("[Scheduler] Dependencies of task %s are met, enqueued", id)
+		return
+	}
+
+	log.Printf("[Scheduler] Task %s %s: %s", id, status, errMsg)
+	if ok {
+		finishedAt := time.Now().UTC()
+		ts.update(task, func(task *Task) { task.FinishedAt = &finishedAt })
+	}
+	ts.notifyFinished(id)
+	ts.releaseDependents(id)
+}
+
+// dependencyOutcome decides what becomes of a task given its parents. ready
+// is false while any parent is still to finish. A "fail" edge beats a
+// "skip" edge; a task whose edges are all satisfied becomes pending.
+func dependencyOutcome(parents []repositories.ParentState) (status string, errMsg string, ready bool) {
+	for _, p := range parents {
+		if !isFinished(p.Status) {
+			return "", "", false
+		}
+	}
+
+	status = models.StatusPending
+	for _, p := range parents {
+		if p.Status == models.StatusCompleted {
+			continue
+		}
+		switch onFailurePolicy(p.OnFailure) {
+		case models.OnFailureRun:
+			continue
+		case models.OnFailureSkip:
+			if status == models.StatusPending {
+				status = models.StatusSkipped
+				errMsg = fmt.Sprintf("dependency %s ended %s", p.ParentID, p.Status)
+			}
+		default:
+			return models.StatusFailed, fmt.Sprintf("dependency %s ended %s", p.ParentID, p.Status), true
+		}
+	}
+	return status, errMsg, true
+}
+
+// validateWorkflow checks keys and edges and rejects cyclic graphs
+func validateWorkflow(spec WorkflowSpec) error {
+	if len(spec.Tasks) == 0 {
+		return errors.New("a workflow needs at least one task")
+	}
+
+	keys := make(map[string]bool, len(spec.Tasks))
+	for _, node := range spec.Tasks {
+		if node.Key == "" {
+			return errors.New("every task needs a key")
+		}
+		if keys[node.Key] {
+			return fmt.Errorf("duplicate task key %q", node.Key)
+		}
+		keys[node.Key] = true
+	}
+
+	// Kahn's algorithm: whatever can't be ordered sits on a cycle
+	indegree := make(map[string]int, len(spec.Tasks))
+	children := make(map[string][]string, len(spec.Tasks))
+	for _, node := range spec.Tasks {
+		seen := make(map[string]bool, len(node.DependsOn))
+		for _, dep := range node.DependsOn {
+			switch {
+			case !keys[dep.Key]:
+				return fmt.Errorf("task %q depends on unknown task %q", node.Key, dep.Key)
+			case dep.Key == node.Key:
+				return fmt.Errorf("task %q depends on itself", node.Key)
+			case seen[dep.Key]:
+				return fmt.Errorf("task %q depends on %q twice", node.Key, dep.Key)
+			case !validOnFailure(dep.OnFailure):
+				return fmt.Errorf("on_failure of %q -> %q must be one of skip, fail, run", dep.Key, node.Key)
+			}
+			seen[dep.Key] = true
+			indegree[node.Key]++
+			children[dep.Key] = append(children[dep.Key], node.Key)
+		}
+	}
+
+	var ready []string
+	for _, node := range spec.Tasks {
+		if indegree[node.Key] == 0 {
+			ready = append(ready, node.Key)
+		}
+	}
+	ordered := 0
+	for len(ready) > 0 {
+		key := ready[len(ready)-1]
+		ready = ready[:len(ready)-1]
+		ordered++
+		for _, child := range children[key] {
+			indegree[child]--
+			if indegree[child] == 0 {
+				ready = append(ready, child)
+			}
+		}
+	}
+	if ordered < len(spec.Tasks) {
+		for _, node := range spec.Tasks {
+			if indegree[node.Key] > 0 {
+				return fmt.Errorf("dependencies form a cycle; task %q can never run", node.Key)
+			}
+		}
+	}
+	return nil
+}
+
+func validOnFailure(policy string) bool {
+	switch policy {
+	case "", models.OnFailureSkip, models.OnFailureFail, models.OnFailureRun:
+		return true
+	}
+	return false
+}
+
+// onFailurePolicy applies the default policy of an edge
+func onFailurePolicy(policy string) string {
+	if policy == "" {
+		return models.OnFailureFail
+	}
+	return policy
+}
+
+func isFinished(status string) bool {
+	for _, s := range models.FinishedStatuses {
+		if status == s {
+			return true
+		}
+	}
+	return false
+}
+
+// buildWorkflow assembles the graph view of a workflow
+func buildWorkflow(workflow *models.Workflow, tasks []*Task, deps []models.TaskDependency) *Workflow {
+	keyOf := make(map[string]string, len(tasks))
+	for _, task := range tasks {
+		keyOf[task.ID] = task.WorkflowKey
+	}
+	parents := make(map[string][]Dependency, len(tasks))
+	for _, dep := range deps {
+		parents[dep.ChildID] = append(parents[dep.ChildID], Dependency{Key: keyOf[dep.ParentID], OnFailure: dep.OnFailure})
+	}
+
+	result := &Workflow{
+		ID:        workflow.ID,
+		Name:      workflow.Name,
+		Status:    WorkflowCompleted,
+		CreatedAt: workflow.CreatedAt,
+		Tasks:     make([]WorkflowNode, 0, len(tasks)),
+	}
+	finished := true
+	for _, task := range tasks {
+		dependsOn := parents[task.ID]
+		if dependsOn == nil {
+			dependsOn = []Dependency{}
+		}
+		result.Tasks = append(result.Tasks, WorkflowNode{Key: task.WorkflowKey, DependsOn: dependsOn, Task: task})
+		switch {
+		case !isFinished(task.Status):
+			finished = false
+		case task.Status != models.StatusCompleted:
+			result.Status = WorkflowFailed
+		}
+	}
+	if !finished {
+		result.Status = WorkflowRunning
+	}
+	return result
+}
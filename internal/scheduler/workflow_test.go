@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+
+	"distributed-task-scheduler/pkg/models"
+	"distributed-task-scheduler/pkg/repositories"
+)
+
+func node(key string, parents ...string) WorkflowTaskSpec {
+	spec := WorkflowTaskSpec{Key: key, Task: TaskSpec{Type: "echo", Priority: Medium}}
+	for _, parent := range parents {
+		spec.DependsOn = append(spec.DependsOn, Dependency{Key: parent})
+	}
+	return spec
+}
+
+func TestValidateWorkflow(t *testing.T) {
+	diamond := WorkflowSpec{Tasks: []WorkflowTaskSpec{node("a"), node("b", "a"), node("c", "a"), node("d", "b", "c")}}
+	if err := validateWorkflow(diamond); err != nil {
+		t.Fatalf("Expected the diamond to be valid, got %v", err)
+	}
+
+	tests := []struct {
+		name string
+		spec WorkflowSpec
+		want string
+	}{
+		{"empty", WorkflowSpec{}, "at least one task"},
+		{"duplicate key", WorkflowSpec{Tasks: []WorkflowTaskSpec{node("a"), node("a")}}, "duplicate"},
+		{"unknown parent", WorkflowSpec{Tasks: []WorkflowTaskSpec{node("a", "x")}}, "unknown task"},
+		{"self loop", WorkflowSpec{Tasks: []WorkflowTaskSpec{node("a", "a")}}, "itself"},
+		{"cycle", WorkflowSpec{Tasks: []WorkflowTaskSpec{node("a"), node("b", "a", "d"), node("c", "b"), node("d", "c")}}, "cycle"},
+		{"bad policy", WorkflowSpec{Tasks: []WorkflowTaskSpec{node("a"), {Key: "b", DependsOn: []Dependency{{Key: "a", OnFailure: "retry"}}}}}, "on_failure"},
+	}
+	for _, tt := range tests {
+		err := validateWorkflow(tt.spec)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestDependencyOutcome(t *testing.T) {
+	parent := func(status, policy string) repositories.ParentState {
+		return repositories.ParentState{ParentID: "p-" + status, Status: status, OnFailure: policy}
+	}
+
+	tests := []struct {
+		name    string
+		parents []repositories.ParentState
+		status  string
+		ready   bool
+	}{
+		{"waiting", []repositories.ParentState{parent(models.StatusCompleted, ""), parent(models.StatusRunning, "")}, "", false},
+		{"all completed", []repositories.ParentState{parent(models.StatusCompleted, ""), parent(models.StatusCompleted, "")}, models.StatusPending, true},
+		{"run anyway", []repositories.ParentState{parent(models.StatusFailed, models.OnFailureRun)}, models.StatusPending, true},
+		{"skip", []repositories.ParentState{parent(models.StatusTimedOut, models.OnFailureSkip)}, models.StatusSkipped, true},
+		{"default fails", []repositories.ParentState{parent(models.StatusCancelled, "")}, models.StatusFailed, true},
+		{"fail beats skip", []repositories.ParentState{parent(models.StatusSkipped, models.OnFailureSkip), parent(models.StatusFailed, models.OnFailureFail)}, models.StatusFailed, true},
+	}
+	for _, tt := range tests {
+		status, _, ready := dependencyOutcome(tt.parents)
+		if status != tt.status || ready != tt.ready {
+			t.Errorf("%s: expected %q (ready %v), got %q (ready %v)", tt.name, tt.status, tt.ready, status, ready)
+		}
+	}
+}
@@ -25,10 +25,11 @@ func TestSubmitAndQueryTask(t *testing.T) {
 	s := scheduler.NewTaskScheduler(queue, taskRepo)
 
 	router := gin.New()
-	routes.RegisterRoutes(router, s)
+	routes.RegisterRoutes(router, s, repositories.NewNodeRepository(db))
 
 	// Submit a task - note the full API prefix /api/v1/tasks
 	taskBody := map[string]interface{}{
+		"type":     "echo",
 		"priority": "high",
 		"payload":  map[string]string{"action": "send_email", "to": "user@example.com"},
 	}
@@ -8,6 +8,7 @@ import (
 	"gorm.io/gorm/logger"
 	"log"
 	"os"
+	"time"
 )
 
 var DB *gorm.DB
@@ -31,9 +32,60 @@ func InitGorm() {
 	}
 
 	// Auto-migrate models
-	if err := DB.AutoMigrate(&models.Task{}); err != nil {
+	if err := DB.AutoMigrate(&models.Task{}, &models.DeadLetter{}, &models.Schedule{}, &models.LeaderLease{}, &models.Node{}, &models.Workflow{}, &models.TaskDependency{}, &models.IdempotencyKey{}, &models.Operation{}, &models.Migration{}); err != nil {
 		log.Fatalf("failed to migrate database: %v", err)
 	}
+	if err := migrateData(DB); err != nil {
+		log.Fatalf("failed to migrate data: %v", err)
+	}
 
 	log.Println("[Database] Connected and migrated successfully")
 }
+
+// dataMigrations rewrite rows in ways AutoMigrate can't. Each runs once, in
+// order, and is recorded in the migrations table.
+var dataMigrations = []struct {
+	id         string
+	statements []string
+}{
+	{
+		// Priorities used to be 0, 1 and 2 for high, medium and low
+		id: "numeric_priorities",
+		statements: []string{
+			"UPDATE tasks SET priority = (ARRAY[100, 500, 900])[priority + 1] WHERE priority IN (0, 1, 2)",
+			"UPDATE dead_letters SET priority = (ARRAY[100, 500, 900])[priority + 1] WHERE priority IN (0, 1, 2)",
+			"UPDATE schedules SET priority = (ARRAY[100, 500, 900])[priority + 1] WHERE priority IN (0, 1, 2)",
+			"UPDATE operations SET priority = (ARRAY[100, 500, 900])[priority + 1] WHERE priority IN (0, 1, 2)",
+		},
+	},
+}
+
+// migrateData applies the data migrations that haven't run yet. The table
+// lock keeps nodes starting at the same time from applying one twice.
+func migrateData(db *gorm.DB) error {
+	for _, m := range dataMigrations {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("LOCK TABLE migrations IN EXCLUSIVE MODE").Error; err != nil {
+				return err
+			}
+			var applied int64
+			if err := tx.Model(&models.Migration{}).Where("id = ?", m.id).Count(&applied).Error; err != nil {
+				return err
+			}
+			if applied > 0 {
+				return nil
+			}
+			for _, stmt := range m.statements {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			log.Printf("[Database] Applied data migration %s", m.id)
+			return tx.Create(&models.Migration{ID: m.id, AppliedAt: time.Now().UTC()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", m.id, err)
+		}
+	}
+	return nil
+}
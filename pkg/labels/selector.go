@@ -0,0 +1,229 @@
+// Package labels parses Kubernetes-style label selectors such as
+// "env=prod,team in (a,b),!legacy".
+package labels
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Operators of a selector requirement
+const (
+	Equals       = "="
+	NotEquals    = "!="
+	In           = "in"
+	NotIn        = "notin"
+	Exists       = "exists"
+	DoesNotExist = "!"
+)
+
+// MaxLength is the longest label key or value accepted
+const MaxLength = 63
+
+var labelPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_./-]*[A-Za-z0-9])?$`)
+
+// Requirement is one comma-separated term of a selector
+type Requirement struct {
+	Key      string
+	Operator string
+	Values   []string // one value for = and !=, none for exists and !
+}
+
+// Selector matches label sets that meet all of its requirements. The empty
+// selector matches everything.
+type Selector []Requirement
+
+// Validate checks a label set for keys and values a selector can address
+func Validate(set map[string]string) error {
+	for k, v := range set {
+		if !validKey(k) {
+			return fmt.Errorf("invalid label key %q", k)
+		}
+		if v != "" && !validValue(v) {
+			return fmt.Errorf("invalid value %q of label %q", v, k)
+		}
+	}
+	return nil
+}
+
+// Parse reads a selector: requirements separated by commas, each one of
+// key=value, key==value, key!=value, key in (v1,v2), key notin (v1,v2),
+// key (the label exists) or !key (it doesn't).
+func Parse(s string) (Selector, error) {
+	var sel Selector
+	for _, term := range splitTerms(s) {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			return nil, fmt.Errorf("empty requirement in selector %q", s)
+		}
+		req, err := parseRequirement(term)
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, req)
+	}
+	return sel, nil
+}
+
+// Matches reports whether the label set meets every requirement
+func (s Selector) Matches(set map[string]string) bool {
+	for _, req := range s {
+		if !req.Matches(set) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches reports whether the label set meets the requirement. Like in
+// Kubernetes, != and notin also match sets without the key.
+func (r Requirement) Matches(set map[string]string) bool {
+	v, ok := set[r.Key]
+	switch r.Operator {
+	case Equals:
+		return ok && v == r.Values[0]
+	case NotEquals:
+		return !ok || v != r.Values[0]
+	case In:
+		return ok && contains(r.Values, v)
+	case NotIn:
+		return !ok || !contains(r.Values, v)
+	case Exists:
+		return ok
+	case DoesNotExist:
+		return !ok
+	}
+	return false
+}
+
+func (s Selector) String() string {
+	terms := make([]string, len(s))
+	for i, r := range s {
+		switch r.Operator {
+		case Equals, NotEquals:
+			terms[i] = r.Key + r.Operator + r.Values[0]
+		case In, NotIn:
+			terms[i] = r.Key + " " + r.Operator + " (" + strings.Join(r.Values, ",") + ")"
+		case Exists:
+			terms[i] = r.Key
+		case DoesNotExist:
+			terms[i] = "!" + r.Key
+		}
+	}
+	return strings.Join(terms, ",")
+}
+
+// MarshalText writes the selector in the syntax Parse reads
+func (s Selector) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText parses a selector written by MarshalText
+func (s *Selector) UnmarshalText(text []byte) error {
+	sel, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*s = sel
+	return nil
+}
+
+// splitTerms splits on commas that aren't inside parentheses
+func splitTerms(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	var terms []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(terms, s[start:])
+}
+
+func parseRequirement(term string) (Requirement, error) {
+	if strings.HasPrefix(term, "!") {
+		key := strings.TrimSpace(term[1:])
+		if !validKey(key) {
+			return Requirement{}, fmt.Errorf("invalid label key %q", key)
+		}
+		return Requirement{Key: key, Operator: DoesNotExist}, nil
+	}
+
+	if i := strings.Index(term, "!="); i >= 0 {
+		return equality(term[:i], NotEquals, term[i+2:])
+	}
+	if i := strings.Index(term, "=="); i >= 0 {
+		return equality(term[:i], Equals, term[i+2:])
+	}
+	if i := strings.Index(term, "="); i >= 0 {
+		return equality(term[:i], Equals, term[i+1:])
+	}
+
+	fields := strings.Fields(term)
+	if len(fields) == 1 {
+		if !validKey(fields[0]) {
+			return Requirement{}, fmt.Errorf("invalid label key %q", fields[0])
+		}
+		return Requirement{Key: fields[0], Operator: Exists}, nil
+	}
+	if len(fields) < 3 || (fields[1] != In && fields[1] != NotIn) {
+		return Requirement{}, fmt.Errorf("cannot parse requirement %q", term)
+	}
+	key, op := fields[0], fields[1]
+	if !validKey(key) {
+		return Requirement{}, fmt.Errorf("invalid label key %q", key)
+	}
+	list := strings.TrimSpace(strings.Join(fields[2:], " "))
+	if !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+		return Requirement{}, fmt.Errorf("values of %q must be in parentheses", term)
+	}
+	var values []string
+	for _, v := range strings.Split(list[1:len(list)-1], ",") {
+		v = strings.TrimSpace(v)
+		if !validValue(v) {
+			return Requirement{}, fmt.Errorf("invalid label value %q in %q", v, term)
+		}
+		values = append(values, v)
+	}
+	return Requirement{Key: key, Operator: op, Values: values}, nil
+}
+
+func equality(key, op, value string) (Requirement, error) {
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if !validKey(key) {
+		return Requirement{}, fmt.Errorf("invalid label key %q", key)
+	}
+	if value != "" && !validValue(value) {
+		return Requirement{}, fmt.Errorf("invalid label value %q", value)
+	}
+	return Requirement{Key: key, Operator: op, Values: []string{value}}, nil
+}
+
+func validKey(k string) bool {
+	return len(k) <= MaxLength && labelPattern.MatchString(k)
+}
+
+func validValue(v string) bool {
+	return len(v) <= MaxLength && labelPattern.MatchString(v)
+}
+
+func contains(values []string, v string) bool {
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package labels
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseAndMatch(t *testing.T) {
+	sel, err := Parse("env=prod, team in (a,b),!legacy,tenant,tier!=gold,region notin (eu)")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(sel) != 6 {
+		t.Fatalf("Expected 6 requirements, got %d: %v", len(sel), sel)
+	}
+
+	tests := []struct {
+		set  map[string]string
+		want bool
+	}{
+		{map[string]string{"env": "prod", "team": "a", "tenant": "x"}, true},
+		{map[string]string{"env": "prod", "team": "b", "tenant": "x", "tier": "silver", "region": "us"}, true},
+		{map[string]string{"env": "dev", "team": "a", "tenant": "x"}, false},
+		{map[string]string{"env": "prod", "team": "c", "tenant": "x"}, false},
+		{map[string]string{"env": "prod", "team": "a", "tenant": "x", "legacy": "true"}, false},
+		{map[string]string{"env": "prod", "team": "a"}, false},
+		{map[string]string{"env": "prod", "team": "a", "tenant": "x", "tier": "gold"}, false},
+		{map[string]string{"env": "prod", "team": "a", "tenant": "x", "region": "eu"}, false},
+	}
+	for _, tt := range tests {
+		if got := sel.Matches(tt.set); got != tt.want {
+			t.Errorf("Matches(%v) = %v, want %v", tt.set, got, tt.want)
+		}
+	}
+
+	if empty, err := Parse(""); err != nil || !empty.Matches(nil) {
+		t.Fatalf("Expected the empty selector to match everything, got %v (err %v)", empty, err)
+	}
+}
+
+func TestParseRejectsInvalid(t *testing.T) {
+	for _, s := range []string{"=prod", "env in a,b", "team in (a,,b)", "a b c", "env=prod,", "bad key=x", "!"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestSelectorJSONRoundTrip(t *testing.T) {
+	sel, err := Parse("env=prod,team in (a,b),!legacy,tenant")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	b, err := json.Marshal(sel)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(b) != `"env=prod,team in (a,b),!legacy,tenant"` {
+		t.Fatalf("Unexpected JSON %s", b)
+	}
+	var back Selector
+	if err := json.Unmarshal(b, &back); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(back, sel) {
+		t.Fatalf("Expected %v after the round trip, got %v", sel, back)
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// DeadLetter keeps a task that failed all of its attempts
+type DeadLetter struct {
+	ID         string         `gorm:"primaryKey" json:"id"`
+	TaskID     string         `gorm:"index" json:"task_id"`
+	Type       string         `json:"type"`
+	Priority   TaskPriority   `json:"priority" swaggertype:"integer" minimum:"0" maximum:"1000"`
+	Payload    interface{}    `json:"payload" gorm:"type:jsonb"`
+	Attempts   int            `json:"attempts"`
+	FinalError string         `json:"final_error"`
+	History    AttemptHistory `json:"history" gorm:"type:jsonb"`
+	CreatedAt  time.Time      `gorm:"index" json:"created_at"` // when the task was dead-lettered
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// IdempotencyKey remembers which task a client-supplied key created, and a
+// fingerprint of the request that created it
+type IdempotencyKey struct {
+	Key         string    `gorm:"primaryKey" json:"key"`
+	TaskID      string    `json:"task_id"`
+	RequestHash string    `json:"request_hash"`
+	CreatedAt   time.Time `json:"created_at"`
+}
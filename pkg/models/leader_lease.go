@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// LeaderLease is the row nodes compete for to become leader. The fencing
+// token grows every time the lease changes hands.
+type LeaderLease struct {
+	Name         string    `gorm:"primaryKey" json:"name"`
+	HolderID     string    `json:"holder_id"`
+	FencingToken int64     `json:"fencing_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import (
+	"time"
+)
+
+// Migration records a data migration that has been applied
+type Migration struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	AppliedAt time.Time `json:"applied_at"`
+}
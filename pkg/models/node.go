@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// Node statuses
+const (
+	NodeAlive   = "alive"
+	NodeDead    = "dead"    // missed too many heartbeats
+	NodeStopped = "stopped" // shut down cleanly
+)
+
+// Node is a cluster member as last reported by its heartbeats
+type Node struct {
+	ID          string    `gorm:"primaryKey" json:"id"`
+	Address     string    `json:"address"`
+	Status      string    `gorm:"index" json:"status"`
+	StartedAt   time.Time `json:"started_at"`
+	LastSeenAt  time.Time `gorm:"index" json:"last_seen_at"`
+	WorkerCount int       `json:"worker_count"`
+	Load        int       `json:"load"` // tasks executing at the last heartbeat
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Actions of a bulk operation
+const (
+	ActionCancel      = "cancel"       // cancel unfinished tasks
+	ActionRequeue     = "requeue"      // reset failed and timed-out tasks to pending
+	ActionSetPriority = "set_priority" // change the priority of pending and blocked tasks
+	ActionDelete      = "delete"       // delete finished tasks
+)
+
+// States of a bulk operation
+const (
+	OperationRunning   = "running"
+	OperationCompleted = "completed"
+	OperationFailed    = "failed"
+)
+
+// RawJSON is a JSON document stored as jsonb and rendered as is
+type RawJSON json.RawMessage
+
+func (j RawJSON) Value() (driver.Value, error) {
+	if len(j) == 0 {
+		return "{}", nil
+	}
+	return string(j), nil
+}
+
+func (j *RawJSON) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*j = nil
+		return nil
+	case []byte:
+		*j = append(RawJSON(nil), v...)
+		return nil
+	case string:
+		*j = RawJSON(v)
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into RawJSON", value)
+	}
+}
+
+func (j RawJSON) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("{}"), nil
+	}
+	return j, nil
+}
+
+func (j *RawJSON) UnmarshalJSON(b []byte) error {
+	*j = append(RawJSON(nil), b...)
+	return nil
+}
+
+// Operation is an action applied to every task matching a filter. It runs in
+// the background on NodeID and records its progress as it goes.
+type Operation struct {
+	ID         string        `gorm:"primaryKey" json:"id"`
+	Action     string        `json:"action"`
+	Filter     RawJSON       `gorm:"type:jsonb" json:"filter" swaggertype:"object"`
+	Priority   *TaskPriority `json:"priority,omitempty" swaggertype:"integer" minimum:"0" maximum:"1000"` // new priority of set_priority
+	Status     string        `gorm:"index" json:"status"`
+	Matched    int           `json:"matched"`   // tasks matching the filter when the operation started
+	Processed  int           `json:"processed"` // of those, how many have been looked at
+	Affected   int           `json:"affected"`  // how many the action applied to
+	Error      string        `json:"error,omitempty"`
+	NodeID     string        `gorm:"index" json:"node_id"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+}
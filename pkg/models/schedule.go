@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// Catch-up policies for runs missed while no leader was evaluating schedules
+const (
+	CatchUpNone = "none" // skip missed runs
+	CatchUpLast = "last" // fire the most recent missed run once
+	CatchUpAll  = "all"  // fire every missed run
+)
+
+// Schedule is a recurring task definition driven by a cron expression
+type Schedule struct {
+	ID         string       `gorm:"primaryKey" json:"id"`
+	Name       string       `json:"name"`
+	Cron       string       `json:"cron"`
+	Timezone   string       `json:"timezone"`
+	Type       string       `json:"type"`
+	Priority   TaskPriority `json:"priority" swaggertype:"integer" minimum:"0" maximum:"1000"`
+	Payload    interface{}  `json:"payload" gorm:"type:jsonb"` // template rendered on every firing
+	CatchUp    string       `json:"catch_up"`
+	LastFireAt *time.Time   `json:"last_fire_at"` // scheduled time of the most recent firing
+	CreatedAt  time.Time    `json:"created_at"`
+}
@@ -1,21 +1,137 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
+// TaskPriority is stored as is; lower values run first
 type TaskPriority int
 
 const (
-	High TaskPriority = iota
-	Medium
-	Low
+	High   TaskPriority = 100
+	Medium TaskPriority = 500
+	Low    TaskPriority = 900
 )
 
+// Task statuses
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+	StatusTimedOut  = "timed_out"
+	StatusBlocked   = "blocked" // waiting for the tasks it depends on
+	StatusSkipped   = "skipped" // not run because a task it depends on didn't complete
+)
+
+// FinishedStatuses are the statuses a task never leaves on its own
+var FinishedStatuses = []string{StatusCompleted, StatusFailed, StatusCancelled, StatusTimedOut, StatusSkipped}
+
+// RetryPolicy is stored inline on the task row with a retry_ column prefix
+type RetryPolicy struct {
+	MaxAttempts    int           `json:"max_attempts"`
+	InitialBackoff time.Duration `json:"initial_backoff" swaggertype:"integer"`
+	Multiplier     float64       `json:"multiplier"`
+	MaxBackoff     time.Duration `json:"max_backoff" swaggertype:"integer"`
+	Jitter         float64       `json:"jitter"`
+}
+
+// Events recorded in a task's history besides its attempts
+const (
+	EventPriorityChanged = "priority_changed"
+)
+
+// AttemptRecord describes one execution attempt of a task, or with Event
+// set, something that happened to it in between; events start and finish
+// at the same time
+type AttemptRecord struct {
+	Attempt    int       `json:"attempt"`
+	Event      string    `json:"event,omitempty"`
+	Detail     string    `json:"detail,omitempty"` // what the event changed, e.g. "900 -> 100"
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// AttemptHistory is stored as a jsonb array
+type AttemptHistory []AttemptRecord
+
+func (h AttemptHistory) Value() (driver.Value, error) {
+	if h == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(h)
+	return string(b), err
+}
+
+func (h *AttemptHistory) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*h = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, h)
+	case string:
+		return json.Unmarshal([]byte(v), h)
+	default:
+		return fmt.Errorf("cannot scan %T into AttemptHistory", value)
+	}
+}
+
+// Labels are free-form key/value tags stored as a jsonb object
+type Labels map[string]string
+
+func (l Labels) Value() (driver.Value, error) {
+	if l == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(l)
+	return string(b), err
+}
+
+func (l *Labels) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, l)
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	default:
+		return fmt.Errorf("cannot scan %T into Labels", value)
+	}
+}
+
 type Task struct {
-	ID        string       `gorm:"primaryKey" json:"id"`
-	Priority  TaskPriority `gorm:"index" json:"priority"`
-	Payload   interface{}  `json:"payload" gorm:"type:jsonb"`
-	CreatedAt time.Time    `json:"created_at"`
-	Status    string       `json:"status"` // pending, running, completed, failed
+	ID        string         `gorm:"primaryKey" json:"id"`
+	Type      string         `gorm:"index" json:"type"`
+	Priority  TaskPriority   `gorm:"index;index:idx_task_claim,priority:2" json:"priority" swaggertype:"integer" minimum:"0" maximum:"1000"`
+	Payload   interface{}    `json:"payload" gorm:"type:jsonb"`
+	CreatedAt time.Time      `gorm:"index:idx_task_claim,priority:3" json:"created_at"`
+	Status    string         `gorm:"index:idx_task_claim,priority:1" json:"status"` // see the Status constants
+	Labels    Labels         `gorm:"type:jsonb;index:idx_task_labels,type:gin" json:"labels"`
+	Result    interface{}    `json:"result" gorm:"type:jsonb"`
+	Error     string         `json:"error"` // error from the most recent attempt
+	Attempts  int            `json:"attempts"`
+	Retry     RetryPolicy    `json:"retry" gorm:"embedded;embeddedPrefix:retry_"`
+	Timeout   time.Duration  `json:"timeout" swaggertype:"integer"` // per attempt; zero means the priority default
+	History   AttemptHistory `json:"history" gorm:"type:jsonb"`
+	RunAt     *time.Time     `gorm:"index" json:"run_at"` // not runnable before this time; nil means immediately
+	// When the latest attempt started and when the task reached its final status
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	// Set while running: the node executing the task and until when its claim
+	// holds. A pending task of an in-memory queue names the node holding it.
+	OwnerNode      string     `gorm:"index" json:"owner_node"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at"`
+	// Set on tasks submitted as part of a workflow
+	WorkflowID  string `gorm:"index" json:"workflow_id,omitempty"`
+	WorkflowKey string `json:"workflow_key,omitempty"`
+	// Set on a running task to ask its owner to abort it
+	CancelRequested bool `gorm:"not null;default:false" json:"cancel_requested"`
 }
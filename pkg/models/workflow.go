@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// What happens to a child when a parent ends without completing
+const (
+	OnFailureSkip = "skip" // the child is skipped
+	OnFailureFail = "fail" // the child fails without running
+	OnFailureRun  = "run"  // the child runs anyway
+)
+
+// Workflow groups tasks that depend on each other
+type Workflow struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TaskDependency is an edge of a workflow graph: ChildID only runs once ParentID has finished
+type TaskDependency struct {
+	WorkflowID string `gorm:"index" json:"workflow_id"`
+	ParentID   string `gorm:"primaryKey" json:"parent_id"`
+	ChildID    string `gorm:"primaryKey;index" json:"child_id"`
+	OnFailure  string `json:"on_failure"` // skip, fail or run
+}
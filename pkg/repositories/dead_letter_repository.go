@@ -0,0 +1,87 @@
+package repositories
+
+import (
+	"distributed-task-scheduler/pkg/models"
+	"gorm.io/gorm"
+)
+
+// MoveToDeadLetter gives the task its final status (failed or timed_out) and
+// stores the dead-letter entry in one transaction
+func (r *TaskRepository) MoveToDeadLetter(dl *models.DeadLetter, status string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Task{}).Where("id = ?", dl.TaskID).Updates(map[string]interface{}{
+			"status":           status,
+			"error":            dl.FinalError,
+			"history":          dl.History,
+			"finished_at":      gorm.Expr("now()"),
+			"owner_node":       "",
+			"lease_expires_at": nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(dl).Error
+	})
+}
+
+// ListDeadLetters returns all dead-letter entries, newest first
+func (r *TaskRepository) ListDeadLetters() ([]models.DeadLetter, error) {
+	var entries []models.DeadLetter
+	err := r.db.Order("created_at DESC").Find(&entries).Error
+	return entries, err
+}
+
+func (r *TaskRepository) GetDeadLetter(id string) (*models.DeadLetter, error) {
+	var entry models.DeadLetter
+	err := r.db.First(&entry, "id = ?", id).Error
+	return &entry, err
+}
+
+// RequeueDeadLetter resets the task behind a dead-letter entry to pending with
+// no attempts, held by holder, and removes the entry. It returns the reset task.
+func (r *TaskRepository) RequeueDeadLetter(id string, holder string) (*models.Task, error) {
+	var task models.Task
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var entry models.DeadLetter
+		if err := tx.First(&entry, "id = ?", id).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&models.Task{}).Where("id = ?", entry.TaskID).Updates(map[string]interface{}{
+			"status":           models.StatusPending,
+			"attempts":         0,
+			"error":            "",
+			"history":          models.AttemptHistory{},
+			"run_at":           nil,
+			"started_at":       nil,
+			"finished_at":      nil,
+			"owner_node":       holder,
+			"cancel_requested": false,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.DeadLetter{}, "id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.First(&task, "id = ?", entry.TaskID).Error
+	})
+	return &task, err
+}
+
+// DeleteDeadLetter drops a single entry; it reports whether the entry existed
+func (r *TaskRepository) DeleteDeadLetter(id string) (bool, error) {
+	res := r.db.Delete(&models.DeadLetter{}, "id = ?", id)
+	return res.RowsAffected > 0, res.Error
+}
+
+// PurgeDeadLetters drops every entry and returns how many were removed
+func (r *TaskRepository) PurgeDeadLetters() (int64, error) {
+	res := r.db.Where("1 = 1").Delete(&models.DeadLetter{})
+	return res.RowsAffected, res.Error
+}
+
+func (r *TaskRepository) CountDeadLetters() (int64, error) {
+	var count int64
+	err := r.db.Model(&models.DeadLetter{}).Count(&count).Error
+	return count, err
+}
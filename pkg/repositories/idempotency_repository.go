@@ -0,0 +1,42 @@
+package repositories
+
+import (
+	"distributed-task-scheduler/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// CreateTaskWithKey stores a task under an idempotency key. If the key was
+// used less than window ago, nothing is stored and the existing key record is
+// returned instead; an older key is taken over by the new task. Concurrent
+// submissions with the same key wait for each other on the key's row.
+func (r *TaskRepository) CreateTaskWithKey(task *models.Task, key string, requestHash string, window time.Duration) (*models.IdempotencyKey, error) {
+	var existing *models.IdempotencyKey
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "key"}},
+			DoUpdates: clause.AssignmentColumns([]string{"task_id", "request_hash", "created_at"}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				gorm.Expr("idempotency_keys.created_at < now() - make_interval(secs => ?)", window.Seconds()),
+			}},
+		}).Create(&models.IdempotencyKey{
+			Key:         key,
+			TaskID:      task.ID,
+			RequestHash: requestHash,
+			CreatedAt:   time.Now().UTC(),
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			existing = &models.IdempotencyKey{}
+			return tx.First(existing, "key = ?", key).Error
+		}
+		return tx.Create(task).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
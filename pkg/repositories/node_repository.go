@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"time"
+
+	"distributed-task-scheduler/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type NodeRepository struct {
+	db *gorm.DB
+}
+
+func NewNodeRepository(db *gorm.DB) *NodeRepository {
+	return &NodeRepository{db: db}
+}
+
+// Heartbeat inserts or refreshes a node row. last_seen_at comes from the
+// database clock so that nodes with skewed clocks are judged alike.
+func (r *NodeRepository) Heartbeat(node *models.Node) error {
+	node.Status = models.NodeAlive
+	return r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"address":      node.Address,
+			"status":       models.NodeAlive,
+			"started_at":   node.StartedAt,
+			"last_seen_at": gorm.Expr("now()"),
+			"worker_count": node.WorkerCount,
+			"load":         node.Load,
+		}),
+	}).Create(node).Error
+}
+
+// MarkDead flags alive nodes that haven't been seen for longer than
+// timeout and returns their IDs
+func (r *NodeRepository) MarkDead(timeout time.Duration) ([]string, error) {
+	var dead []models.Node
+	err := r.db.Model(&dead).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+		Where("status = ? AND last_seen_at < now() - make_interval(secs => ?)", models.NodeAlive, timeout.Seconds()).
+		Update("status", models.NodeDead).Error
+	ids := make([]string, 0, len(dead))
+	for _, n := range dead {
+		ids = append(ids, n.ID)
+	}
+	return ids, err
+}
+
+// SetStatus changes the status of one node
+func (r *NodeRepository) SetStatus(id string, status string) error {
+	return r.db.Model(&models.Node{}).Where("id = ?", id).Update("status", status).Error
+}
+
+// List returns all known nodes ordered by ID
+func (r *NodeRepository) List() ([]models.Node, error) {
+	var nodes []models.Node
+	err := r.db.Order("id").Find(&nodes).Error
+	return nodes, err
+}
@@ -0,0 +1,115 @@
+package repositories
+
+import (
+	"strconv"
+
+	"distributed-task-scheduler/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (r *TaskRepository) CreateOperation(op *models.Operation) error {
+	return r.db.Create(op).Error
+}
+
+func (r *TaskRepository) GetOperation(id string) (*models.Operation, error) {
+	var op models.Operation
+	err := r.db.First(&op, "id = ?", id).Error
+	return &op, err
+}
+
+// UpdateOperationProgress records how far a running operation has got
+func (r *TaskRepository) UpdateOperationProgress(id string, processed int, affected int) error {
+	return r.db.Model(&models.Operation{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"processed":  processed,
+		"affected":   affected,
+		"updated_at": gorm.Expr("now()"),
+	}).Error
+}
+
+// FinishOperation moves an operation to its final status
+func (r *TaskRepository) FinishOperation(id string, status string, errMsg string) error {
+	return r.db.Model(&models.Operation{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      status,
+		"error":       errMsg,
+		"updated_at":  gorm.Expr("now()"),
+		"finished_at": gorm.Expr("now()"),
+	}).Error
+}
+
+// AbandonOperations fails the operations a node left running when it went
+// down and returns how many there were
+func (r *TaskRepository) AbandonOperations(nodeID string, errMsg string) (int64, error) {
+	res := r.db.Model(&models.Operation{}).
+		Where("node_id = ? AND status = ?", nodeID, models.OperationRunning).
+		Updates(map[string]interface{}{
+			"status":      models.OperationFailed,
+			"error":       errMsg,
+			"updated_at":  gorm.Expr("now()"),
+			"finished_at": gorm.Expr("now()"),
+		})
+	return res.RowsAffected, res.Error
+}
+
+// MatchingTaskIDs returns the IDs of every task matching the filter, oldest first
+func (r *TaskRepository) MatchingTaskIDs(filter TaskFilter) ([]string, error) {
+	var ids []string
+	err := r.db.Model(&models.Task{}).Scopes(filter.Scope).Order("created_at, id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+// RequeueTasks resets the failed and timed-out tasks matching the filter to
+// pending with no attempts, held by holder, like RequeueDeadLetter does for
+// one, and drops their dead-letter entries. It returns the reset tasks and how
+// many entries were dropped.
+func (r *TaskRepository) RequeueTasks(filter TaskFilter, holder string) ([]models.Task, int64, error) {
+	var tasks []models.Task
+	var dropped int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&tasks).
+			Clauses(clause.Returning{}).
+			Scopes(filter.Scope).
+			Where("status IN ?", []string{models.StatusFailed, models.StatusTimedOut}).
+			Updates(map[string]interface{}{
+				"status":           models.StatusPending,
+				"attempts":         0,
+				"error":            "",
+				"history":          models.AttemptHistory{},
+				"run_at":           nil,
+				"started_at":       nil,
+				"finished_at":      nil,
+				"owner_node":       holder,
+				"cancel_requested": false,
+			}).Error
+		if err != nil || len(tasks) == 0 {
+			return err
+		}
+		ids := make([]string, len(tasks))
+		for i, t := range tasks {
+			ids[i] = t.ID
+		}
+		res := tx.Where("task_id IN ?", ids).Delete(&models.DeadLetter{})
+		dropped = res.RowsAffected
+		return res.Error
+	})
+	return tasks, dropped, err
+}
+
+// SetTaskPriority changes the priority of the pending and blocked tasks
+// matching the filter, records the change in their history and returns them.
+// Tasks that are running or finished keep their priority.
+func (r *TaskRepository) SetTaskPriority(filter TaskFilter, priority models.TaskPriority) ([]models.Task, error) {
+	var tasks []models.Task
+	err := r.db.Model(&tasks).
+		Clauses(clause.Returning{}).
+		Scopes(filter.Scope).
+		Where("status IN ? AND priority <> ?", []string{models.StatusPending, models.StatusBlocked}, priority).
+		Updates(map[string]interface{}{
+			"priority": priority,
+			// The right-hand side still sees the old priority
+			"history": gorm.Expr(`COALESCE(history, '[]'::jsonb) || jsonb_build_array(jsonb_build_object(
+				'attempt', attempts, 'event', ?::text, 'detail', priority::text || ' -> ' || ?::text,
+				'started_at', now(), 'finished_at', now()))`, models.EventPriorityChanged, strconv.Itoa(int(priority))),
+		}).Error
+	return tasks, err
+}
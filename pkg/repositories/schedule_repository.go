@@ -0,0 +1,42 @@
+package repositories
+
+import (
+	"distributed-task-scheduler/pkg/models"
+	"time"
+)
+
+func (r *TaskRepository) CreateSchedule(schedule *models.Schedule) error {
+	return r.db.Create(schedule).Error
+}
+
+// ListSchedules returns all schedules, oldest first
+func (r *TaskRepository) ListSchedules() ([]models.Schedule, error) {
+	var schedules []models.Schedule
+	err := r.db.Order("created_at").Find(&schedules).Error
+	return schedules, err
+}
+
+func (r *TaskRepository) GetSchedule(id string) (*models.Schedule, error) {
+	var schedule models.Schedule
+	err := r.db.First(&schedule, "id = ?", id).Error
+	return &schedule, err
+}
+
+// DeleteSchedule removes a schedule; it reports whether the schedule existed
+func (r *TaskRepository) DeleteSchedule(id string) (bool, error) {
+	res := r.db.Delete(&models.Schedule{}, "id = ?", id)
+	return res.RowsAffected > 0, res.Error
+}
+
+// AdvanceSchedule moves last_fire_at from prev to next, but only if no other
+// node has moved it in the meantime. It reports whether this caller won.
+func (r *TaskRepository) AdvanceSchedule(id string, prev *time.Time, next time.Time) (bool, error) {
+	q := r.db.Model(&models.Schedule{}).Where("id = ?", id)
+	if prev == nil {
+		q = q.Where("last_fire_at IS NULL")
+	} else {
+		q = q.Where("last_fire_at = ?", *prev)
+	}
+	res := q.Update("last_fire_at", next)
+	return res.RowsAffected > 0, res.Error
+}
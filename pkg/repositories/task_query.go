@@ -0,0 +1,204 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"distributed-task-scheduler/pkg/labels"
+	"distributed-task-scheduler/pkg/models"
+	"gorm.io/gorm"
+)
+
+// Sort orders for task listings. Ties are broken by creation time and ID so
+// that every order is total and can be paged through with a cursor.
+const (
+	SortCreatedAt = "created_at" // oldest first
+	SortPriority  = "priority"   // the order the queue runs tasks in
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+)
+
+// ErrInvalidCursor is returned for cursors that weren't issued for the query
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// TaskFilter narrows down which tasks a query matches; zero fields match everything
+type TaskFilter struct {
+	Statuses      []string              `json:"statuses,omitempty"`
+	Priorities    []models.TaskPriority `json:"priorities,omitempty"`
+	Types         []string              `json:"types,omitempty"`
+	CreatedAfter  *time.Time            `json:"created_after,omitempty"`
+	CreatedBefore *time.Time            `json:"created_before,omitempty"`
+	Labels        labels.Selector       `json:"selector,omitempty"`
+	IDs           []string              `json:"-"` // narrows a bulk operation down to one batch
+}
+
+// TaskQuery is one page of a filtered, sorted task listing
+type TaskQuery struct {
+	TaskFilter
+	Sort      string // SortCreatedAt (default) or SortPriority
+	Desc      bool
+	Limit     int    // page size, default 50, at most 1000
+	Cursor    string // NextCursor of the previous page
+	WithTotal bool   // also count every matching task
+}
+
+// TaskPage is a page of tasks and the cursor of the page after it
+type TaskPage struct {
+	Tasks      []models.Task
+	NextCursor string // empty on the last page
+	Total      *int64
+}
+
+// taskCursor is the position after the last task of a page
+type taskCursor struct {
+	Sort      string    `json:"s"`
+	Desc      bool      `json:"d,omitempty"`
+	Priority  int       `json:"p"`
+	CreatedAt time.Time `json:"c"`
+	ID        string    `json:"i"`
+}
+
+// Scope applies the filter to a query on the tasks table
+func (f TaskFilter) Scope(db *gorm.DB) *gorm.DB {
+	if len(f.IDs) > 0 {
+		db = db.Where("id IN ?", f.IDs)
+	}
+	if len(f.Statuses) > 0 {
+		db = db.Where("status IN ?", f.Statuses)
+	}
+	if len(f.Priorities) > 0 {
+		db = db.Where("priority IN ?", f.Priorities)
+	}
+	if len(f.Types) > 0 {
+		db = db.Where("type IN ?", f.Types)
+	}
+	if f.CreatedAfter != nil {
+		db = db.Where("created_at >= ?", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		db = db.Where("created_at < ?", *f.CreatedBefore)
+	}
+	for _, req := range f.Labels {
+		db = whereLabel(db, req)
+	}
+	return db
+}
+
+// IsEmpty reports whether the filter matches every task
+func (f TaskFilter) IsEmpty() bool {
+	return len(f.IDs) == 0 && len(f.Statuses) == 0 && len(f.Priorities) == 0 && len(f.Types) == 0 &&
+		f.CreatedAfter == nil && f.CreatedBefore == nil && len(f.Labels) == 0
+}
+
+// whereLabel adds a selector requirement. Equality is expressed as jsonb
+// containment so that it can use the GIN index on labels.
+func whereLabel(db *gorm.DB, req labels.Requirement) *gorm.DB {
+	containsAny := func(values []string) (string, []interface{}) {
+		terms := make([]string, len(values))
+		args := make([]interface{}, len(values))
+		for i, v := range values {
+			b, _ := json.Marshal(map[string]string{req.Key: v})
+			terms[i] = "labels @> ?::jsonb"
+			args[i] = string(b)
+		}
+		return "(" + strings.Join(terms, " OR ") + ")", args
+	}
+
+	switch req.Operator {
+	case labels.Equals, labels.In:
+		sql, args := containsAny(req.Values)
+		return db.Where(sql, args...)
+	case labels.NotEquals, labels.NotIn:
+		sql, args := containsAny(req.Values)
+		return db.Where("(labels IS NULL OR NOT "+sql+")", args...)
+	case labels.Exists:
+		return db.Where("labels ->> ? IS NOT NULL", req.Key)
+	case labels.DoesNotExist:
+		return db.Where("labels ->> ? IS NULL", req.Key)
+	}
+	return db
+}
+
+// ListTasks returns one page of the tasks matching the query. Paging is
+// keyset based, so pages stay stable while tasks are being added.
+func (r *TaskRepository) ListTasks(q TaskQuery) (*TaskPage, error) {
+	if q.Sort == "" {
+		q.Sort = SortCreatedAt
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultPageSize
+	}
+	if q.Limit > maxPageSize {
+		q.Limit = maxPageSize
+	}
+
+	columns := []string{"created_at", "id"}
+	if q.Sort == SortPriority {
+		columns = []string{"priority", "created_at", "id"}
+	}
+	dir, cmp := "", ">"
+	if q.Desc {
+		dir, cmp = " DESC", "<"
+	}
+	order := strings.Join(columns, dir+", ") + dir
+
+	page := &TaskPage{}
+	if q.WithTotal {
+		var total int64
+		if err := r.db.Model(&models.Task{}).Scopes(q.TaskFilter.Scope).Count(&total).Error; err != nil {
+			return nil, err
+		}
+		page.Total = &total
+	}
+
+	db := r.db.Scopes(q.TaskFilter.Scope)
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil || c.Sort != q.Sort || c.Desc != q.Desc {
+			return nil, ErrInvalidCursor
+		}
+		if q.Sort == SortPriority {
+			db = db.Where("(priority, created_at, id) "+cmp+" (?, ?, ?)", c.Priority, c.CreatedAt, c.ID)
+		} else {
+			db = db.Where("(created_at, id) "+cmp+" (?, ?)", c.CreatedAt, c.ID)
+		}
+	}
+
+	// One extra row tells whether another page follows
+	if err := db.Order(order).Limit(q.Limit + 1).Find(&page.Tasks).Error; err != nil {
+		return nil, err
+	}
+	if len(page.Tasks) > q.Limit {
+		page.Tasks = page.Tasks[:q.Limit]
+		last := page.Tasks[q.Limit-1]
+		page.NextCursor = encodeCursor(taskCursor{
+			Sort:      q.Sort,
+			Desc:      q.Desc,
+			Priority:  int(last.Priority),
+			CreatedAt: last.CreatedAt,
+			ID:        last.ID,
+		})
+	}
+	return page, nil
+}
+
+func encodeCursor(c taskCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (taskCursor, error) {
+	var c taskCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
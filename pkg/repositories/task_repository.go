@@ -3,6 +3,8 @@ package repositories
 import (
 	"distributed-task-scheduler/pkg/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
 )
 
 type TaskRepository struct {
@@ -17,25 +19,354 @@ func (r *TaskRepository) Create(task *models.Task) error {
 	return r.db.Create(task).Error
 }
 
+// createBatchSize keeps multi-row INSERTs well below Postgres' limit of 65535 bind parameters
+const createBatchSize = 1000
+
+// CreateBatch inserts many tasks with multi-row INSERTs in one transaction;
+// either all of them are stored or none
+func (r *TaskRepository) CreateBatch(tasks []*models.Task) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return tx.CreateInBatches(tasks, createBatchSize).Error
+	})
+}
+
 func (r *TaskRepository) UpdateStatus(id string, status string) error {
 	return r.db.Model(&models.Task{}).Where("id = ?", id).Update("status", status).Error
 }
 
+// StartAttempt marks a task running on owner, stores its attempt counter and
+// leases the task to owner for the given duration. Only pending tasks, or
+// tasks owner already claimed with ClaimNextTask, can be started. It reports
+// false, leaving the row alone, if the task was cancelled in the meantime or
+// is running on another node.
+func (r *TaskRepository) StartAttempt(id string, attempts int, owner string, lease time.Duration) (bool, error) {
+	res := r.db.Model(&models.Task{}).
+		Where("id = ? AND NOT cancel_requested", id).
+		Where("status = ? OR (status = ? AND owner_node = ?)", models.StatusPending, models.StatusRunning, owner).
+		Updates(map[string]interface{}{
+			"status":           models.StatusRunning,
+			"attempts":         attempts,
+			"started_at":       gorm.Expr("now()"),
+			"owner_node":       owner,
+			"lease_expires_at": leaseExpiry(lease),
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+// ClaimNextTask picks the most urgent due pending task, marks it running on
+// owner and leases it, all in one transaction. Rows locked by other claimers
+// are skipped. It returns nil when nothing is due.
+//
+// With a positive perPriority, waiting makes up for priority: a task counts as
+// ready since its run_at, or its creation without one, plus perPriority for
+// every unit of priority, and the earliest such time goes first.
+func (r *TaskRepository) ClaimNextTask(owner string, lease time.Duration, perPriority time.Duration) (*models.Task, error) {
+	order := clause.Expr{SQL: "priority, created_at"}
+	if perPriority > 0 {
+		order = gorm.Expr("COALESCE(run_at, created_at) + priority * make_interval(secs => ?), created_at", perPriority.Seconds())
+	}
+
+	var task models.Task
+	claimed := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND (run_at IS NULL OR run_at <= now())", models.StatusPending).
+			Clauses(clause.OrderBy{Expression: order}).
+			Limit(1).
+			Find(&task)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		claimed = true
+		return tx.Model(&task).Updates(map[string]interface{}{
+			"status":           models.StatusRunning,
+			"owner_node":       owner,
+			"lease_expires_at": leaseExpiry(lease),
+		}).Error
+	})
+	if err != nil || !claimed {
+		return nil, err
+	}
+	task.Status = models.StatusRunning
+	task.OwnerNode = owner
+	return &task, nil
+}
+
+// CountDueTasks counts pending tasks that may run now
+func (r *TaskRepository) CountDueTasks() (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Task{}).
+		Where("status = ? AND (run_at IS NULL OR run_at <= now())", models.StatusPending).
+		Count(&count).Error
+	return count, err
+}
+
+// ReleaseOwnedTasks puts tasks left running by owner, or by no one, back to
+// pending. Those that were being cancelled are marked cancelled with cancelMsg
+// instead. A restarting node calls it for its own ID.
+func (r *TaskRepository) ReleaseOwnedTasks(owner string, cancelMsg string) error {
+	owned := func(db *gorm.DB) *gorm.DB {
+		return db.Where("status = ? AND (owner_node = ? OR owner_node = '' OR owner_node IS NULL)", models.StatusRunning, owner)
+	}
+
+	err := r.db.Model(&models.Task{}).
+		Scopes(owned).
+		Where("cancel_requested").
+		Updates(map[string]interface{}{
+			"status":           models.StatusCancelled,
+			"error":            cancelMsg,
+			"finished_at":      gorm.Expr("now()"),
+			"owner_node":       "",
+			"lease_expires_at": nil,
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	return r.db.Model(&models.Task{}).
+		Scopes(owned).
+		Updates(map[string]interface{}{
+			"status":           models.StatusPending,
+			"owner_node":       "",
+			"lease_expires_at": nil,
+		}).Error
+}
+
+// CancelTasks cancels every pending or blocked task matching the filter and
+// flags the matching running tasks so that their owners abort them. It
+// returns the tasks of both groups.
+func (r *TaskRepository) CancelTasks(filter TaskFilter, errMsg string) (cancelled []models.Task, requested []models.Task, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&cancelled).
+			Clauses(clause.Returning{}).
+			Scopes(filter.Scope).
+			Where("status IN ?", []string{models.StatusPending, models.StatusBlocked}).
+			Updates(map[string]interface{}{
+				"status":      models.StatusCancelled,
+				"error":       errMsg,
+				"finished_at": gorm.Expr("now()"),
+			}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&requested).
+			Clauses(clause.Returning{}).
+			Scopes(filter.Scope).
+			Where("status = ? AND NOT cancel_requested", models.StatusRunning).
+			Update("cancel_requested", true).Error
+	})
+	return cancelled, requested, err
+}
+
+// DeleteTasks removes the finished tasks matching the filter together with
+// their dependency edges and dead-letter entries. It returns the IDs of the
+// removed tasks and how many dead-letter entries went with them.
+func (r *TaskRepository) DeleteTasks(filter TaskFilter) ([]string, int64, error) {
+	var ids []string
+	var dropped int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var tasks []models.Task
+		err := tx.Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+			Scopes(filter.Scope).
+			Where("status IN ?", models.FinishedStatuses).
+			Delete(&tasks).Error
+		if err != nil || len(tasks) == 0 {
+			return err
+		}
+		for _, t := range tasks {
+			ids = append(ids, t.ID)
+		}
+		if err := tx.Where("parent_id IN ? OR child_id IN ?", ids, ids).Delete(&models.TaskDependency{}).Error; err != nil {
+			return err
+		}
+		res := tx.Where("task_id IN ?", ids).Delete(&models.DeadLetter{})
+		dropped = res.RowsAffected
+		return res.Error
+	})
+	return ids, dropped, err
+}
+
+// RenewLease extends owner's lease on a running task. It reports false if the
+// task is no longer running on owner, e.g. because it was reclaimed, and
+// whether someone asked for the task to be cancelled.
+func (r *TaskRepository) RenewLease(id string, owner string, lease time.Duration) (held bool, cancelRequested bool, err error) {
+	var tasks []models.Task
+	res := r.db.Model(&tasks).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "cancel_requested"}}}).
+		Where("id = ? AND owner_node = ? AND status = ?", id, owner, models.StatusRunning).
+		Update("lease_expires_at", leaseExpiry(lease))
+	if res.Error != nil || len(tasks) == 0 {
+		return false, false, res.Error
+	}
+	return true, tasks[0].CancelRequested, nil
+}
+
+// CancelTask cancels a pending or blocked task outright and flags a running one so that
+// its owner aborts it. It returns the status the task had before;
+// finished tasks are left untouched.
+func (r *TaskRepository) CancelTask(id string, errMsg string) (string, error) {
+	var status string
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var task models.Task
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").First(&task, "id = ?", id).Error; err != nil {
+			return err
+		}
+		status = task.Status
+		switch task.Status {
+		case models.StatusPending, models.StatusBlocked:
+			return tx.Model(&task).Updates(map[string]interface{}{
+				"status":      models.StatusCancelled,
+				"error":       errMsg,
+				"finished_at": gorm.Expr("now()"),
+			}).Error
+		case models.StatusRunning:
+			return tx.Model(&task).Update("cancel_requested", true).Error
+		}
+		return nil
+	})
+	return status, err
+}
+
+// ScheduleRetry puts a failed task back to pending, due at runAt, and keeps
+// the error of the failed attempt. holder is the node whose in-memory queue
+// takes the task back, or empty for the shared queue. It reports false,
+// leaving the row alone, if the task was asked to be cancelled meanwhile.
+func (r *TaskRepository) ScheduleRetry(id string, errMsg string, history models.AttemptHistory, runAt time.Time, holder string) (bool, error) {
+	res := r.db.Model(&models.Task{}).Where("id = ? AND NOT cancel_requested", id).Updates(map[string]interface{}{
+		"status":           models.StatusPending,
+		"error":            errMsg,
+		"history":          history,
+		"run_at":           runAt,
+		"owner_node":       holder,
+		"lease_expires_at": nil,
+	})
+	return res.RowsAffected > 0, res.Error
+}
+
+// ReleaseAttempt hands a task that owner started back to pending as if the
+// attempt never happened: attempts is the count from before it started.
+// holder is the node whose in-memory queue is to pick the task up again, or
+// empty for the shared queue. A task that was asked to be cancelled is marked
+// cancelled with cancelMsg instead, which is reported as true. Tasks owner no
+// longer runs are left alone.
+func (r *TaskRepository) ReleaseAttempt(id string, owner string, attempts int, holder string, cancelMsg string) (bool, error) {
+	owned := func(db *gorm.DB) *gorm.DB {
+		return db.Where("id = ? AND status = ? AND owner_node = ?", id, models.StatusRunning, owner)
+	}
+
+	res := r.db.Model(&models.Task{}).
+		Scopes(owned).
+		Where("cancel_requested").
+		Updates(map[string]interface{}{
+			"status":           models.StatusCancelled,
+			"error":            cancelMsg,
+			"finished_at":      gorm.Expr("now()"),
+			"owner_node":       "",
+			"lease_expires_at": nil,
+		})
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.RowsAffected > 0, res.Error
+	}
+
+	return false, r.db.Model(&models.Task{}).
+		Scopes(owned).
+		Where("NOT cancel_requested").
+		Updates(map[string]interface{}{
+			"status":           models.StatusPending,
+			"attempts":         attempts,
+			"started_at":       nil,
+			"owner_node":       holder,
+			"lease_expires_at": nil,
+		}).Error
+}
+
+// SaveResult records the terminal status of a task together with what its handler returned
+func (r *TaskRepository) SaveResult(id string, status string, result interface{}, errMsg string, history models.AttemptHistory) error {
+	return r.db.Model(&models.Task{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":           status,
+		"result":           result,
+		"error":            errMsg,
+		"history":          history,
+		"finished_at":      gorm.Expr("now()"),
+		"owner_node":       "",
+		"lease_expires_at": nil,
+	}).Error
+}
+
+// ReclaimOrphanedTasks puts running tasks back to pending when their owner
+// has died or left, or when their lease ran out. Orphans that were being
+// cancelled are marked cancelled instead. With a holder, pending tasks that
+// sat in the in-memory queue of a node that died or left move to holder too.
+// It returns the reclaimed tasks, which holder is to enqueue.
+func (r *TaskRepository) ReclaimOrphanedTasks(cancelMsg string, holder string) ([]models.Task, error) {
+	goneNodes := r.db.Model(&models.Node{}).Select("id").Where("status IN ?", []string{models.NodeDead, models.NodeStopped})
+	orphaned := func(db *gorm.DB) *gorm.DB {
+		return db.Where("status = ?", models.StatusRunning).
+			Where("lease_expires_at < now() OR owner_node IN (?)", goneNodes)
+	}
+
+	err := r.db.Model(&models.Task{}).
+		Scopes(orphaned).
+		Where("cancel_requested").
+		Updates(map[string]interface{}{
+			"status":           models.StatusCancelled,
+			"error":            cancelMsg,
+			"finished_at":      gorm.Expr("now()"),
+			"owner_node":       "",
+			"lease_expires_at": nil,
+		}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []models.Task
+	err = r.db.Model(&tasks).
+		Clauses(clause.Returning{}).
+		Scopes(orphaned).
+		Updates(map[string]interface{}{
+			"status":           models.StatusPending,
+			"error":            gorm.Expr("'lease lost: owner node ' || owner_node || ' stopped renewing'"),
+			"owner_node":       holder,
+			"lease_expires_at": nil,
+		}).Error
+	if err != nil || holder == "" {
+		return tasks, err
+	}
+
+	var held []models.Task
+	err = r.db.Model(&held).
+		Clauses(clause.Returning{}).
+		Where("status = ? AND owner_node IN (?)", models.StatusPending, goneNodes).
+		Update("owner_node", holder).Error
+	return append(tasks, held...), err
+}
+
 func (r *TaskRepository) GetByID(id string) (*models.Task, error) {
 	var task models.Task
 	err := r.db.First(&task, "id = ?", id).Error
 	return &task, err
 }
 
-func (r *TaskRepository) GetUnfinishedTasks() ([]models.Task, error) {
-	var tasks []models.Task
-	err := r.db.Where("status IN ?", []string{"pending", "running"}).Find(&tasks).Error
-	return tasks, err
+// TaskExists reports whether a task with the given ID has been stored
+func (r *TaskRepository) TaskExists(id string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Task{}).Where("id = ?", id).Count(&count).Error
+	return count > 0, err
 }
 
-// GetAll returns all tasks in the database
-func (r *TaskRepository) GetAll() ([]models.Task, error) {
+// GetRecoverableTasks returns the tasks a restarting node should pick up: the
+// pending and running tasks it held itself, plus those held by no node, as
+// rows from before task ownership existed are. Tasks held in other nodes'
+// queues or running elsewhere are left alone.
+func (r *TaskRepository) GetRecoverableTasks(nodeID string) ([]models.Task, error) {
 	var tasks []models.Task
-	err := r.db.Find(&tasks).Error
+	err := r.db.Where("status IN ?", []string{models.StatusPending, models.StatusRunning}).
+		Where("owner_node = ? OR owner_node = '' OR owner_node IS NULL", nodeID).
+		Find(&tasks).Error
 	return tasks, err
 }
+
+// leaseExpiry is a lease deadline computed with the database clock
+func leaseExpiry(lease time.Duration) clause.Expr {
+	return gorm.Expr("now() + make_interval(secs => ?)", lease.Seconds())
+}
@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"distributed-task-scheduler/pkg/models"
+	"gorm.io/gorm"
+)
+
+// ParentState is the status of a parent task as seen through one dependency edge
+type ParentState struct {
+	ParentID  string
+	Status    string
+	OnFailure string
+}
+
+// CreateWorkflow stores a workflow with all of its tasks and edges in one transaction
+func (r *TaskRepository) CreateWorkflow(workflow *models.Workflow, tasks []*models.Task, deps []models.TaskDependency) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(workflow).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(tasks).Error; err != nil {
+			return err
+		}
+		if len(deps) == 0 {
+			return nil
+		}
+		return tx.Create(&deps).Error
+	})
+}
+
+func (r *TaskRepository) GetWorkflow(id string) (*models.Workflow, error) {
+	var workflow models.Workflow
+	err := r.db.First(&workflow, "id = ?", id).Error
+	return &workflow, err
+}
+
+// WorkflowTasks returns the tasks of a workflow in submission order
+func (r *TaskRepository) WorkflowTasks(workflowID string) ([]models.Task, error) {
+	var tasks []models.Task
+	err := r.db.Where("workflow_id = ?", workflowID).Order("created_at, workflow_key").Find(&tasks).Error
+	return tasks, err
+}
+
+// WorkflowDependencies returns every edge of a workflow
+func (r *TaskRepository) WorkflowDependencies(workflowID string) ([]models.TaskDependency, error) {
+	var deps []models.TaskDependency
+	err := r.db.Where("workflow_id = ?", workflowID).Find(&deps).Error
+	return deps, err
+}
+
+// DependentTaskIDs returns the children of a task
+func (r *TaskRepository) DependentTaskIDs(parentID string) ([]string, error) {
+	var ids []string
+	err := r.db.Model(&models.TaskDependency{}).Where("parent_id = ?", parentID).Pluck("child_id", &ids).Error
+	return ids, err
+}
+
+// ParentStates returns the current status of every parent of a task
+func (r *TaskRepository) ParentStates(childID string) ([]ParentState, error) {
+	var states []ParentState
+	err := r.db.Table("task_dependencies AS d").
+		Select("d.parent_id, p.status, d.on_failure").
+		Joins("JOIN tasks AS p ON p.id = d.parent_id").
+		Where("d.child_id = ?", childID).
+		Scan(&states).Error
+	return states, err
+}
+
+// ResolveBlockedTask moves a blocked task to status, which is pending once it
+// may run; a pending task is then held by holder. It reports false if the
+// task wasn't blocked anymore, so only one caller acts on a resolution.
+func (r *TaskRepository) ResolveBlockedTask(id string, status string, errMsg string, holder string) (bool, error) {
+	updates := map[string]interface{}{
+		"status": status,
+		"error":  errMsg,
+	}
+	if status == models.StatusPending {
+		updates["owner_node"] = holder
+	} else {
+		updates["finished_at"] = gorm.Expr("now()")
+	}
+	res := r.db.Model(&models.Task{}).
+		Where("id = ? AND status = ?", id, models.StatusBlocked).
+		Updates(updates)
+	return res.RowsAffected > 0, res.Error
+}
+
+// ResolvableBlockedTaskIDs returns blocked tasks whose parents have all finished
+func (r *TaskRepository) ResolvableBlockedTaskIDs() ([]string, error) {
+	var ids []string
+	err := r.db.Model(&models.Task{}).
+		Where("status = ?", models.StatusBlocked).
+		Where("NOT EXISTS (?)", r.db.Table("task_dependencies AS d").
+			Select("1").
+			Joins("JOIN tasks AS p ON p.id = d.parent_id").
+			Where("d.child_id = tasks.id AND p.status NOT IN ?", models.FinishedStatuses)).
+		Pluck("id", &ids).Error
+	return ids, err
+}